@@ -70,6 +70,7 @@ type auth struct {
 	names     names
 	db        DB
 	providers []provider.Provider
+	chain     []Authenticator
 }
 
 type paths struct {
@@ -102,7 +103,7 @@ func (o Options) apply(a *auth) error {
 	var err error
 
 	for _, option := range o {
-		err = errors.Join(option.apply(a))
+		err = errors.Join(err, option.apply(a))
 	}
 
 	return err
@@ -157,6 +158,27 @@ func WithProvider(p provider.Provider, key, secret, callbackDomain, source strin
 	})
 }
 
+// SetAuthenticators replaces the default bearer token, session, and OIDC authenticators used on the auth routes.
+// They are tried in the given order and the first one to succeed wins.
+func SetAuthenticators(list ...Authenticator) Option {
+	return option(func(a *auth) error {
+
+		if len(list) < 1 {
+			return ErrEmptyArgument
+		}
+
+		for _, single := range list {
+			if single == nil {
+				return ErrEmptyArgument
+			}
+		}
+
+		a.chain = list
+
+		return nil
+	})
+}
+
 func SetStore(store sessions.Store) Option {
 	return option(func(a *auth) error {
 
@@ -285,7 +307,7 @@ func New(g *echo.Echo, opts ...Option) error {
 	var err error
 
 	for _, opt := range opts {
-		err = errors.Join(opt.apply(a))
+		err = errors.Join(err, opt.apply(a))
 	}
 
 	if err != nil {
@@ -309,16 +331,17 @@ func New(g *echo.Echo, opts ...Option) error {
 		return ErrMissingDB
 	}
 
-	group := g.Group("/auth",
-		MiddlewareBearerToken(a.db),
-		MiddlewareSessionManager(a.session, a.names.session),
-		MiddlewareOIDC(),
-	)
+	if len(a.chain) < 1 {
+		a.chain = a.authenticators()
+	}
+
+	group := g.Group("/auth", MiddlewareAuthenticators(a.chain...))
 
 	group.GET(fmt.Sprintf("/add/:%s", a.names.provider), a.addExistingAccount, MiddlewareMustBeAuthenticated(a.db))
 	group.GET(fmt.Sprintf("/login/:%s", a.names.provider), a.login)
 	group.GET(fmt.Sprintf("/callback/:%s", a.names.provider), a.callback)
 	group.GET("/logout", a.logout, MiddlewareMustBeAuthenticated(a.db))
+	group.POST("/logout", a.logout, MiddlewareMustBeAuthenticated(a.db))
 	group.GET("/providers", a.listProviders)
 	group.GET(fmt.Sprintf("/refetch/:%s", a.names.provider), a.refetch, MiddlewareMustBeAuthenticated(a.db))
 	group.GET("/whoami", a.whoami)
@@ -326,6 +349,15 @@ func New(g *echo.Echo, opts ...Option) error {
 	return nil
 }
 
+// authenticators returns the default chain: bearer token, then session, then OIDC.
+func (a *auth) authenticators() []Authenticator {
+	return []Authenticator{
+		AuthenticatorBearerToken(a.db),
+		AuthenticatorSessionManager(a.session, a.names.session),
+		AuthenticatorOIDC(),
+	}
+}
+
 func (a *auth) redirect(c echo.Context, path string, internal bool) error {
 
 	if a.frontend != nil && internal {
@@ -343,6 +375,11 @@ func (a *auth) redirect(c echo.Context, path string, internal bool) error {
 
 	a.logger.LogAttrs(context.Background(), slog.LevelDebug, "redirecting", slog.Bool("internal", internal), slog.String("to", path))
 
+	// A temporary redirect would repeat the POST at the new location.
+	if c.Request().Method == http.MethodPost {
+		return c.Redirect(http.StatusSeeOther, path)
+	}
+
 	return c.Redirect(http.StatusTemporaryRedirect, path)
 }
 
@@ -321,3 +321,48 @@ func TestEr(t *testing.T) {
 	check.NoError(e.Shutdown(ctx))
 
 }
+
+func TestLogoutPost(t *testing.T) {
+
+	check := require.New(t)
+
+	db, usr := newTestUser(t)
+
+	e := echo.New()
+	sm := scs.New()
+
+	e.Use(session.LoadAndSave(sm))
+
+	check.NoError(New(e,
+		SetDatabase(db),
+		SetSessions(sm),
+		SetLogger(slogt.New(t)),
+		SetPaths("/", "/logged-out", "/", "/"),
+	))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+usr.Tokens[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusSeeOther, rec.Code)
+	check.Equal("/logged-out", rec.Header().Get(echo.HeaderLocation))
+
+}
+
+func TestNewOptionErrors(t *testing.T) {
+
+	check := require.New(t)
+
+	err := New(echo.New(), SetAuthenticators(), SetLogger(nil), SetDatabase(&dummy.DB{}))
+	check.ErrorIs(err, ErrEmptyArgument)
+	check.ErrorIs(err, ErrLoggerIsInvalid)
+
+	err = Options{SetSessions(nil), SetStore(nil)}.apply(&auth{})
+	check.ErrorIs(err, ErrSessionsIsNil)
+	check.ErrorIs(err, ErrSessionsStoreIsNil)
+}
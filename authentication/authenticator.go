@@ -0,0 +1,242 @@
+package authentication
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"strings"
+
+	"github.com/hcarriz/reverb/password"
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/labstack/echo/v4"
+	"github.com/markbates/goth/gothic"
+)
+
+// Authorization schemes, in the lower case returned by parseAuthorization.
+const (
+	SchemeBasic  = "basic"
+	SchemeBearer = "bearer"
+)
+
+// DefaultAPIKeyHeader is the header read by AuthenticatorAPIKey when none is given.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// PasswordDB extends DB for use with AuthenticatorBasic.
+type PasswordDB interface {
+	DB
+	GetUserPasswordHash(ctx context.Context, username string) (userID string, hash string, err error) // Get the user id and the hash created by the password package for the username.
+}
+
+// PasswordRehasher is implemented by a PasswordDB that can replace the hash of a user.
+// AuthenticatorBasic uses it to upgrade outdated hashes after a successful login.
+type PasswordRehasher interface {
+	SetUserPasswordHash(ctx context.Context, userID string, hash string) error
+}
+
+// APIKeyDB extends DB for use with AuthenticatorAPIKey.
+type APIKeyDB interface {
+	DB
+	GetUserIDFromAPIKey(ctx context.Context, key string) (userID string, err error) // Get the user id that owns the api key.
+}
+
+// Authenticator identifies the user behind a request.
+// It has the same method set as reverb.Auth, so any Authenticator can be given to reverb.WithAuth.
+type Authenticator interface {
+	Authenticate(echo.Context) (context.Context, bool)
+}
+
+// AuthenticatorFunc allows a plain function to be used as an Authenticator.
+type AuthenticatorFunc func(echo.Context) (context.Context, bool)
+
+func (f AuthenticatorFunc) Authenticate(c echo.Context) (context.Context, bool) {
+	return f(c)
+}
+
+// AuthenticatorBearerToken authenticates requests with an api token in the Authorization header.
+// Authenticated requests are marked with viewer.SetBearer, which exempts them from csrf.
+func AuthenticatorBearerToken(db DB) Authenticator {
+	return AuthenticatorFunc(func(c echo.Context) (context.Context, bool) {
+
+		ctx := c.Request().Context()
+
+		scheme, tk, ok := parseAuthorization(c.Request().Header.Get(echo.HeaderAuthorization))
+		if !ok || scheme != SchemeBearer {
+			return ctx, false
+		}
+
+		usrID, err := db.GetUserIDFromToken(ctx, tk)
+		if err != nil || usrID == "" {
+			return ctx, false
+		}
+
+		return viewer.SetBearer(withUser(ctx, usrID)), true
+	})
+}
+
+// BasicOption configures AuthenticatorBasic.
+type BasicOption func(*basic)
+
+type basic struct {
+	logger Log
+}
+
+// BasicLogger sets the logger used to report hashes that could not be upgraded, slog.Default by default.
+func BasicLogger(logger Log) BasicOption {
+	return func(b *basic) {
+		if logger != nil {
+			b.logger = logger
+		}
+	}
+}
+
+// AuthenticatorBasic authenticates requests using HTTP Basic credentials.
+// The password is checked with registry against the hash returned by the database, disabled users are rejected.
+// If the database is a PasswordRehasher, outdated hashes are replaced with ones from registry.
+// Peppered hashes need a registry with the peppers, a nil registry uses password.Default as it is when called.
+func AuthenticatorBasic(db PasswordDB, registry *password.Registry, opts ...BasicOption) Authenticator {
+
+	if registry == nil {
+		registry = password.Default
+	}
+
+	b := basic{
+		logger: slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(&b)
+	}
+
+	// Used when the user does not exist, so that unknown users take as long as known users.
+	missing, _ := registry.Hash("missing")
+
+	return AuthenticatorFunc(func(c echo.Context) (context.Context, bool) {
+
+		ctx := c.Request().Context()
+
+		scheme, encoded, ok := parseAuthorization(c.Request().Header.Get(echo.HeaderAuthorization))
+		if !ok || scheme != SchemeBasic {
+			return ctx, false
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return ctx, false
+		}
+
+		username, plaintext, ok := strings.Cut(string(raw), ":")
+		if !ok || username == "" {
+			return ctx, false
+		}
+
+		usrID, hash, err := db.GetUserPasswordHash(ctx, username)
+		if err != nil || usrID == "" {
+			if missing != "" {
+				_, _ = registry.Verify(plaintext, missing)
+			}
+			return ctx, false
+		}
+
+		result, err := registry.Verify(plaintext, hash)
+		if err != nil || !result.Match {
+			return ctx, false
+		}
+
+		if disabled, err := db.UserDisabled(ctx, usrID); err != nil || disabled {
+			return ctx, false
+		}
+
+		if rehasher, ok := db.(PasswordRehasher); ok && result.Outdated {
+
+			upgraded, err := registry.Hash(plaintext)
+			if err == nil {
+				err = rehasher.SetUserPasswordHash(ctx, usrID, upgraded)
+			}
+
+			// The login still succeeds, the hash is upgraded on a later one.
+			if err != nil {
+				b.logger.LogAttrs(ctx, slog.LevelError, "unable to upgrade password hash", slog.String("user", usrID), slog.String("error", err.Error()))
+			}
+		}
+
+		return withUser(ctx, usrID), true
+	})
+}
+
+// AuthenticatorAPIKey authenticates requests with a key in the given header.
+// If header is empty, DefaultAPIKeyHeader is used. Disabled users are rejected.
+func AuthenticatorAPIKey(db APIKeyDB, header string) Authenticator {
+
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+
+	return AuthenticatorFunc(func(c echo.Context) (context.Context, bool) {
+
+		ctx := c.Request().Context()
+
+		key := strings.TrimSpace(c.Request().Header.Get(header))
+		if key == "" {
+			return ctx, false
+		}
+
+		usrID, err := db.GetUserIDFromAPIKey(ctx, key)
+		if err != nil || usrID == "" {
+			return ctx, false
+		}
+
+		if disabled, err := db.UserDisabled(ctx, usrID); err != nil || disabled {
+			return ctx, false
+		}
+
+		return withUser(ctx, usrID), true
+	})
+}
+
+// AuthenticatorSessionManager authenticates requests with the user id stored in the session under key.
+func AuthenticatorSessionManager(session Session, key string) Authenticator {
+	return AuthenticatorFunc(func(c echo.Context) (context.Context, bool) {
+
+		ctx := c.Request().Context()
+
+		usrID := session.GetString(ctx, key)
+		if usrID == "" {
+			return ctx, false
+		}
+
+		return withUser(ctx, usrID), true
+	})
+}
+
+// AuthenticatorOIDC authenticates requests that have completed authentication with a provider.
+func AuthenticatorOIDC() Authenticator {
+	return AuthenticatorFunc(func(c echo.Context) (context.Context, bool) {
+
+		ctx := c.Request().Context()
+
+		user, err := gothic.CompleteUserAuth(c.Response(), c.Request())
+		if err != nil || user.UserID == "" {
+			return ctx, false
+		}
+
+		return withUser(ctx, user.UserID), true
+	})
+}
+
+// MiddlewareAuthenticators tries each Authenticator in order. The first one to succeed sets the request context.
+// Requests that no Authenticator accepts continue without a user.
+func MiddlewareAuthenticators(list ...Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			for _, single := range list {
+				if ctx, ok := single.Authenticate(c); ok {
+					c.SetRequest(c.Request().WithContext(ctx))
+					break
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/authentication/dummy"
+	"github.com/hcarriz/reverb/password"
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/icrowley/fake"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestUser returns a database with a single user, who has an api token.
+func newTestUser(t *testing.T) (*dummy.DB, dummy.User) {
+
+	t.Helper()
+
+	check := require.New(t)
+
+	db := &dummy.DB{}
+
+	id, err := db.CreateOrUpdateUser(context.Background(), "gothic", "faux", fake.EmailAddress(), fake.FullName())
+	check.NoError(err)
+
+	raw, err := db.GetUser(context.Background(), id)
+	check.NoError(err)
+
+	usr, ok := raw.(dummy.User)
+	check.True(ok)
+	check.NotEmpty(usr.Tokens)
+
+	return db, usr
+}
+
+func TestAuthenticators(t *testing.T) {
+
+	check := require.New(t)
+
+	db, usr := newTestUser(t)
+	id := usr.ID
+
+	sm := scs.New()
+
+	e := echo.New()
+
+	var (
+		found  string
+		bearer bool
+	)
+
+	handler := MiddlewareAuthenticators(
+		AuthenticatorBearerToken(db),
+		AuthenticatorSessionManager(sm, "app_session"),
+	)(func(c echo.Context) error {
+		found, _ = c.Request().Context().Value("user").(string)
+		bearer = viewer.IsBearer(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	// No credentials.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx, err := sm.Load(req.Context(), "")
+	check.NoError(err)
+	req = req.WithContext(ctx)
+
+	check.NoError(handler(e.NewContext(req, httptest.NewRecorder())))
+	check.Empty(found)
+
+	// Bearer token.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+usr.Tokens[0])
+	ctx, err = sm.Load(req.Context(), "")
+	check.NoError(err)
+	req = req.WithContext(ctx)
+
+	check.NoError(handler(e.NewContext(req, httptest.NewRecorder())))
+	check.Equal(id, found)
+	check.True(bearer)
+
+	// Invalid bearer token falls through to the session.
+	found = ""
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer invalid")
+	ctx, err = sm.Load(req.Context(), "")
+	check.NoError(err)
+	sm.Put(ctx, "app_session", "from_session")
+	req = req.WithContext(ctx)
+
+	check.NoError(handler(e.NewContext(req, httptest.NewRecorder())))
+	check.Equal("from_session", found)
+	check.False(bearer, "only a valid bearer token exempts the request from csrf")
+
+}
+
+func TestMiddlewareBearerToken(t *testing.T) {
+
+	check := require.New(t)
+
+	e := echo.New()
+
+	handler := MiddlewareBearerToken(&dummy.DB{})(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	check.NoError(handler(e.NewContext(req, rec)))
+	check.Equal(http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer invalid")
+	rec = httptest.NewRecorder()
+	check.NoError(handler(e.NewContext(req, rec)))
+	check.Equal(http.StatusUnauthorized, rec.Code)
+
+	// A token without a user continues unauthenticated, as it always has.
+	var found string
+
+	handler = MiddlewareBearerToken(ownerless{&dummy.DB{}})(func(c echo.Context) error {
+		found, _ = c.Request().Context().Value("user").(string)
+		return c.NoContent(http.StatusOK)
+	})
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer ownerless")
+	rec = httptest.NewRecorder()
+	check.NoError(handler(e.NewContext(req, rec)))
+	check.Equal(http.StatusOK, rec.Code)
+	check.Empty(found)
+
+}
+
+// ownerless resolves every token to no user.
+type ownerless struct {
+	*dummy.DB
+}
+
+func (ownerless) GetUserIDFromToken(context.Context, string) (string, error) {
+	return "", nil
+}
+
+func TestAuthenticatorBasicAndAPIKey(t *testing.T) {
+
+	check := require.New(t)
+
+	db, usr := newTestUser(t)
+	id := usr.ID
+	bg := context.Background()
+
+	hash, err := password.Create("correct horse battery staple")
+	check.NoError(err)
+
+	check.NoError(db.SetUserPasswordHash(bg, id, hash.String()))
+	check.NoError(db.AddAPIKeyToUser(bg, id, "the-api-key"))
+
+	basic := func(user, pass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+
+	e := echo.New()
+
+	var found string
+
+	handler := MiddlewareAuthenticators(
+		AuthenticatorBearerToken(db),
+		AuthenticatorBasic(db, nil),
+		AuthenticatorAPIKey(db, ""),
+	)(func(c echo.Context) error {
+		found, _ = c.Request().Context().Value("user").(string)
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "basic", headers: map[string]string{echo.HeaderAuthorization: basic(usr.Email, "correct horse battery staple")}, want: id},
+		{name: "basic lower case scheme", headers: map[string]string{echo.HeaderAuthorization: "basic " + strings.TrimPrefix(basic(usr.Email, "correct horse battery staple"), "Basic ")}, want: id},
+		{name: "basic wrong password", headers: map[string]string{echo.HeaderAuthorization: basic(usr.Email, "wrong")}},
+		{name: "basic unknown user", headers: map[string]string{echo.HeaderAuthorization: basic("nobody", "correct horse battery staple")}},
+		{name: "basic malformed", headers: map[string]string{echo.HeaderAuthorization: "Basic not-base64!"}},
+		{name: "api key", headers: map[string]string{DefaultAPIKeyHeader: "the-api-key"}, want: id},
+		{name: "api key unknown", headers: map[string]string{DefaultAPIKeyHeader: "other"}},
+		{name: "unknown scheme", headers: map[string]string{echo.HeaderAuthorization: "Digest " + usr.Tokens[0]}},
+		{name: "bare token", headers: map[string]string{echo.HeaderAuthorization: usr.Tokens[0]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			found = ""
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			check.NoError(handler(e.NewContext(req, httptest.NewRecorder())))
+			check.Equal(tt.want, found)
+		})
+	}
+
+}
+
+func TestAuthenticatorBasicRehash(t *testing.T) {
+
+	check := require.New(t)
+
+	db, usr := newTestUser(t)
+	id := usr.ID
+	bg := context.Background()
+
+	legacy, err := password.Bcrypt(bcrypt.MinCost).Hash("correct horse battery staple")
+	check.NoError(err)
+
+	check.NoError(db.SetUserPasswordHash(bg, id, legacy))
+
+	e := echo.New()
+	e.Use(MiddlewareAuthenticators(AuthenticatorBasic(db, nil)))
+	e.GET("/", func(c echo.Context) error {
+		found, _ := c.Request().Context().Value("user").(string)
+		return c.String(http.StatusOK, found)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(usr.Email, "correct horse battery staple")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+	check.Equal(id, rec.Body.String())
+
+	_, upgraded, err := db.GetUserPasswordHash(bg, usr.Email)
+	check.NoError(err)
+	check.True(strings.HasPrefix(upgraded, "$argon2id$"))
+
+	result, err := password.Verify("correct horse battery staple", upgraded)
+	check.NoError(err)
+	check.Equal(password.Result{Match: true}, result)
+
+}
+
+type failingRehasher struct {
+	*dummy.DB
+}
+
+func (failingRehasher) SetUserPasswordHash(context.Context, string, string) error {
+	return errors.New("read only")
+}
+
+func TestAuthenticatorBasicRehashError(t *testing.T) {
+
+	check := require.New(t)
+
+	db, usr := newTestUser(t)
+	id := usr.ID
+	bg := context.Background()
+
+	legacy, err := password.Bcrypt(bcrypt.MinCost).Hash("correct horse battery staple")
+	check.NoError(err)
+
+	check.NoError(db.SetUserPasswordHash(bg, id, legacy))
+
+	var buf bytes.Buffer
+
+	e := echo.New()
+	e.Use(MiddlewareAuthenticators(AuthenticatorBasic(failingRehasher{db}, nil, BasicLogger(slog.New(slog.NewTextHandler(&buf, nil))))))
+	e.GET("/", func(c echo.Context) error {
+		found, _ := c.Request().Context().Value("user").(string)
+		return c.String(http.StatusOK, found)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(usr.Email, "correct horse battery staple")
+	rec := httptest.NewRecorder()
+
+	// The login succeeds even though the hash could not be upgraded.
+	e.ServeHTTP(rec, req)
+	check.Equal(id, rec.Body.String())
+
+	check.Contains(buf.String(), "unable to upgrade password hash")
+	check.Contains(buf.String(), "read only")
+
+}
+
+func TestParseAuthorization(t *testing.T) {
+
+	check := require.New(t)
+
+	scheme, credentials, ok := parseAuthorization("Bearer  abc ")
+	check.True(ok)
+	check.Equal(SchemeBearer, scheme)
+	check.Equal("abc", credentials)
+
+	for _, header := range []string{"", "Bearer", "Bearer ", " abc"} {
+		_, _, ok := parseAuthorization(header)
+		check.False(ok, header)
+	}
+
+}
+
+func TestAuthenticatorBasicPepper(t *testing.T) {
+
+	check := require.New(t)
+
+	db, usr := newTestUser(t)
+	id := usr.ID
+	bg := context.Background()
+
+	fast := []password.Option{password.Iterations(1), password.Memory(8 * 1024), password.Parallelism(1)}
+
+	first := password.Pepper("first", bytes.Repeat([]byte{1}, 32))
+	second := password.Pepper("second", bytes.Repeat([]byte{2}, 32))
+
+	registry := password.NewRegistry(password.Argon2(append(fast, first)...))
+
+	hash, err := registry.Hash("correct horse battery staple")
+	check.NoError(err)
+	check.NoError(db.SetUserPasswordHash(bg, id, hash))
+
+	login := func(registry *password.Registry) string {
+
+		e := echo.New()
+		e.Use(MiddlewareAuthenticators(AuthenticatorBasic(db, registry)))
+		e.GET("/", func(c echo.Context) error {
+			found, _ := c.Request().Context().Value("user").(string)
+			return c.String(http.StatusOK, found)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(usr.Email, "correct horse battery staple")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		return rec.Body.String()
+	}
+
+	// Without the pepper the hash can not be verified.
+	check.Empty(login(nil))
+	check.Equal(id, login(registry))
+
+	// Rotating the pepper upgrades the hash on login.
+	rotated := password.NewRegistry(password.Argon2(append(fast, second, first)...))
+
+	check.Equal(id, login(rotated))
+
+	_, upgraded, err := db.GetUserPasswordHash(bg, usr.Email)
+	check.NoError(err)
+	check.Contains(upgraded, "k=second")
+
+	check.Empty(login(registry))
+	check.Equal(id, login(rotated))
+
+}
@@ -0,0 +1,182 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrMissingClientCA    = errors.New("missing client certificate authority")
+	ErrInvalidCertificate = errors.New("invalid certificate")
+)
+
+// Certificate is the identity presented by a verified client certificate.
+type Certificate struct {
+	Subject        string   // Distinguished name of the subject.
+	CommonName     string   // Common name of the subject.
+	DNSNames       []string // DNS subject alternative names.
+	EmailAddresses []string // Email subject alternative names.
+	URIs           []string // URI subject alternative names, i.e. SPIFFE ids.
+	Fingerprint    string   // Hex encoded SHA-256 of the DER certificate.
+}
+
+// CertificateFrom returns the identity of the certificate.
+func CertificateFrom(cert *x509.Certificate) Certificate {
+
+	sum := sha256.Sum256(cert.Raw)
+
+	c := Certificate{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Fingerprint:    hex.EncodeToString(sum[:]),
+	}
+
+	for _, u := range cert.URIs {
+		c.URIs = append(c.URIs, u.String())
+	}
+
+	return c
+}
+
+// CertificateDB extends DB for use with AuthenticatorClientCertificate.
+type CertificateDB interface {
+	DB
+	GetIdentityFromCertificate(ctx context.Context, cert Certificate) (id string, service bool, err error) // Get the user id, or the service name if service is true, that the certificate belongs to.
+}
+
+// AuthenticatorClientCertificate authenticates requests with a client certificate that was verified during the TLS handshake.
+// Users are added to the context like every other Authenticator, services are added with viewer.SetService only.
+// Services that need system access must be granted it explicitly, i.e. by a middleware checking viewer.GetService.
+func AuthenticatorClientCertificate(db CertificateDB) Authenticator {
+	return AuthenticatorFunc(func(c echo.Context) (context.Context, bool) {
+
+		ctx := c.Request().Context()
+
+		state := c.Request().TLS
+		if state == nil || len(state.VerifiedChains) < 1 || len(state.VerifiedChains[0]) < 1 {
+			return ctx, false
+		}
+
+		id, service, err := db.GetIdentityFromCertificate(ctx, CertificateFrom(state.VerifiedChains[0][0]))
+		if err != nil || id == "" {
+			return ctx, false
+		}
+
+		if service {
+			return viewer.SetService(ctx, id), true
+		}
+
+		if disabled, err := db.UserDisabled(ctx, id); err != nil || disabled {
+			return ctx, false
+		}
+
+		return withUser(ctx, id), true
+	})
+}
+
+// TLSOption configures the *tls.Config built by ClientTLSConfig.
+type TLSOption interface {
+	apply(*tls.Config) error
+}
+
+type tlsOption func(*tls.Config) error
+
+func (o tlsOption) apply(c *tls.Config) error {
+	return o(c)
+}
+
+// ClientCAs adds PEM encoded certificate authorities that client certificates must be signed by.
+func ClientCAs(pem []byte) TLSOption {
+	return tlsOption(func(c *tls.Config) error {
+
+		if c.ClientCAs == nil {
+			c.ClientCAs = x509.NewCertPool()
+		}
+
+		if !c.ClientCAs.AppendCertsFromPEM(pem) {
+			return ErrInvalidCertificate
+		}
+
+		return nil
+	})
+}
+
+// ClientCAPool sets the pool of certificate authorities that client certificates must be signed by.
+func ClientCAPool(pool *x509.CertPool) TLSOption {
+	return tlsOption(func(c *tls.Config) error {
+
+		if pool == nil {
+			return ErrMissingClientCA
+		}
+
+		c.ClientCAs = pool
+
+		return nil
+	})
+}
+
+// ServerCertificate adds a certificate for the server to present.
+func ServerCertificate(cert tls.Certificate) TLSOption {
+	return tlsOption(func(c *tls.Config) error {
+		c.Certificates = append(c.Certificates, cert)
+		return nil
+	})
+}
+
+// ServerKeyPair adds a PEM encoded certificate and key for the server to present.
+func ServerKeyPair(certPEM, keyPEM []byte) TLSOption {
+	return tlsOption(func(c *tls.Config) error {
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return err
+		}
+
+		c.Certificates = append(c.Certificates, cert)
+
+		return nil
+	})
+}
+
+// OptionalClientCertificate verifies client certificates when they are given, but does not require them.
+// Use it when clients without certificates should fall through to other Authenticators.
+func OptionalClientCertificate() TLSOption {
+	return tlsOption(func(c *tls.Config) error {
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+		return nil
+	})
+}
+
+// ClientTLSConfig builds a server *tls.Config that requires and verifies client certificates.
+func ClientTLSConfig(opts ...TLSOption) (*tls.Config, error) {
+
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+
+	var err error
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(c))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ClientCAs == nil {
+		return nil, ErrMissingClientCA
+	}
+
+	return c, nil
+}
@@ -0,0 +1,247 @@
+package authentication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/authentication/dummy"
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/icrowley/fake"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T) authority {
+
+	check := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check.NoError(err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	check.NoError(err)
+
+	cert, err := x509.ParseCertificate(der)
+	check.NoError(err)
+
+	return authority{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (a authority) issue(t *testing.T, tmpl *x509.Certificate) (tls.Certificate, *x509.Certificate) {
+
+	check := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check.NoError(err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	check.NoError(err)
+
+	cert, err := x509.ParseCertificate(der)
+	check.NoError(err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+type identity struct {
+	id      string
+	service bool
+}
+
+type certificateDB struct {
+	*dummy.DB
+	identities map[string]identity
+}
+
+func (d certificateDB) GetIdentityFromCertificate(_ context.Context, cert Certificate) (string, bool, error) {
+
+	if found, ok := d.identities[cert.Fingerprint]; ok {
+		return found.id, found.service, nil
+	}
+
+	return "", false, dummy.ErrNoUser
+}
+
+func TestClientTLSConfig(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := ClientTLSConfig()
+	check.ErrorIs(err, ErrMissingClientCA)
+
+	_, err = ClientTLSConfig(ClientCAs([]byte("not a certificate")))
+	check.ErrorIs(err, ErrInvalidCertificate)
+
+	_, err = ClientTLSConfig(ClientCAPool(nil))
+	check.ErrorIs(err, ErrMissingClientCA)
+
+	ca := newAuthority(t)
+
+	cfg, err := ClientTLSConfig(ClientCAs(ca.pem))
+	check.NoError(err)
+	check.Equal(tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	cfg, err = ClientTLSConfig(ClientCAs(ca.pem), OptionalClientCertificate())
+	check.NoError(err)
+	check.Equal(tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+
+}
+
+func TestAuthenticatorClientCertificate(t *testing.T) {
+
+	check := require.New(t)
+
+	ca := newAuthority(t)
+	other := newAuthority(t)
+
+	server, _ := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+
+	spiffe, err := url.Parse("spiffe://example.com/worker")
+	check.NoError(err)
+
+	userCert, userX509 := ca.issue(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "user"},
+		EmailAddresses: []string{"user@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	serviceCert, serviceX509 := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "worker"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	unknownCert, _ := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "unknown"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	foreignCert, _ := other.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "foreign"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	identified := CertificateFrom(serviceX509)
+	check.Equal("worker", identified.CommonName)
+	check.Equal([]string{spiffe.String()}, identified.URIs)
+	check.Len(identified.Fingerprint, 64)
+
+	db := certificateDB{DB: &dummy.DB{}, identities: map[string]identity{}}
+
+	userID, err := db.CreateOrUpdateUser(context.Background(), "gothic", "faux", fake.EmailAddress(), fake.FullName())
+	check.NoError(err)
+
+	db.identities[CertificateFrom(userX509).Fingerprint] = identity{id: userID}
+	db.identities[identified.Fingerprint] = identity{id: "worker", service: true}
+
+	cfg, err := ClientTLSConfig(ClientCAs(ca.pem), ServerCertificate(server), OptionalClientCertificate())
+	check.NoError(err)
+
+	e := echo.New()
+	e.Use(MiddlewareAuthenticators(AuthenticatorClientCertificate(db)))
+	e.GET("/", func(c echo.Context) error {
+
+		ctx := c.Request().Context()
+
+		// Services are not given system access.
+		if viewer.IsSystem(ctx) {
+			return c.String(http.StatusOK, "system")
+		}
+
+		if svc, ok := viewer.GetService(ctx); ok {
+			return c.String(http.StatusOK, "service:"+svc)
+		}
+
+		if id, ok := viewer.GetUserID[string](ctx); ok {
+			return c.String(http.StatusOK, "user:"+id)
+		}
+
+		return c.String(http.StatusOK, "anonymous")
+	})
+
+	ts := httptest.NewUnstartedServer(e)
+	ts.TLS = cfg
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(certs ...tls.Certificate) (string, error) {
+
+		cl := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+		}}}
+
+		resp, err := cl.Get(ts.URL)
+		if err != nil {
+			return "", err
+		}
+
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+
+		return string(b), err
+	}
+
+	body, err := get()
+	check.NoError(err)
+	check.Equal("anonymous", body)
+
+	body, err = get(userCert)
+	check.NoError(err)
+	check.Equal("user:"+userID, body)
+
+	body, err = get(serviceCert)
+	check.NoError(err)
+	check.Equal("service:worker", body)
+
+	body, err = get(unknownCert)
+	check.NoError(err)
+	check.Equal("anonymous", body)
+
+	_, err = get(foreignCert)
+	check.Error(err)
+
+}
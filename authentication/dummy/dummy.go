@@ -18,6 +18,8 @@ type User struct {
 	Gothic   []string
 	Sessions []string
 	Tokens   []string
+	Password string
+	APIKeys  []string
 }
 
 type DB struct {
@@ -128,3 +130,49 @@ func (d *DB) AddSessionToUser(_ context.Context, gothID, session string) error {
 
 	return ErrNoUser
 }
+
+func (d *DB) GetUserPasswordHash(_ context.Context, username string) (string, string, error) {
+
+	for _, single := range d.users {
+		if single.Email == username && single.Password != "" {
+			return single.ID, single.Password, nil
+		}
+	}
+
+	return "", "", ErrNoUser
+}
+
+func (d *DB) SetUserPasswordHash(_ context.Context, userID, hash string) error {
+
+	for x, single := range d.users {
+		if single.ID == userID {
+			d.users[x].Password = hash
+			return nil
+		}
+	}
+
+	return ErrNoUser
+}
+
+func (d *DB) GetUserIDFromAPIKey(_ context.Context, key string) (string, error) {
+
+	for _, single := range d.users {
+		if slices.Contains(single.APIKeys, key) {
+			return single.ID, nil
+		}
+	}
+
+	return "", ErrNoUser
+}
+
+func (d *DB) AddAPIKeyToUser(_ context.Context, userID, key string) error {
+
+	for x, single := range d.users {
+		if single.ID == userID {
+			d.users[x].APIKeys = append(single.APIKeys, key)
+			return nil
+		}
+	}
+
+	return ErrNoUser
+}
@@ -3,23 +3,19 @@ package authentication
 import (
 	"context"
 	"net/http"
-	"strings"
 
 	"ariga.io/sqlcomment"
+	"github.com/hcarriz/reverb/viewer"
 	"github.com/labstack/echo/v4"
-	"github.com/markbates/goth/gothic"
 )
 
-func setUser(c echo.Context, id string) echo.Context {
+func withUser(ctx context.Context, id string) context.Context {
 
-	if id == "" {
-		return c
-	}
-
-	ctx := context.WithValue(c.Request().Context(), "user", id)
+	ctx = context.WithValue(ctx, "user", id)
 	ctx = sqlcomment.WithTag(ctx, "user", id)
+	ctx = viewer.SetUserID(ctx, id)
 
-	return c.Echo().NewContext(c.Request().Clone(ctx), c.Response())
+	return ctx
 
 }
 
@@ -42,36 +38,34 @@ func MiddlewareMustBeAuthenticated(db DB) echo.MiddlewareFunc {
 }
 
 func MiddlewareSessionManager(session Session, key string) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-
-			if usrID := session.GetString(c.Request().Context(), key); usrID != "" {
-				c = setUser(c, usrID)
-			}
-
-			return next(c)
-		}
-	}
+	return MiddlewareAuthenticators(AuthenticatorSessionManager(session, key))
 }
 
+// MiddlewareBearerToken authenticates requests with an api token in the Authorization header.
+// A header that is not a known token is rejected with 401, a token that belongs to no user continues unauthenticated.
 func MiddlewareBearerToken(db DB) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 
-			if tk := c.Request().Header.Get("Authorization"); tk != "" {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if header == "" {
+				return next(c)
+			}
 
-				b := strings.Split(tk, " ")
-				if len(b) == 2 {
-					tk = b[1]
-				}
+			scheme, tk, ok := parseAuthorization(header)
+			if !ok || scheme != SchemeBearer {
+				return c.NoContent(http.StatusUnauthorized)
+			}
 
-				usrID, err := db.GetUserIDFromToken(c.Request().Context(), tk)
-				if err != nil {
-					return c.NoContent(http.StatusUnauthorized)
-				}
+			ctx := c.Request().Context()
 
-				c = setUser(c, usrID)
+			usrID, err := db.GetUserIDFromToken(ctx, tk)
+			if err != nil {
+				return c.NoContent(http.StatusUnauthorized)
+			}
 
+			if usrID != "" {
+				c.SetRequest(c.Request().WithContext(viewer.SetBearer(withUser(ctx, usrID))))
 			}
 
 			return next(c)
@@ -80,14 +74,5 @@ func MiddlewareBearerToken(db DB) echo.MiddlewareFunc {
 }
 
 func MiddlewareOIDC() echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-
-			if user, err := gothic.CompleteUserAuth(c.Response(), c.Request()); err == nil {
-				c = setUser(c, user.UserID)
-			}
-
-			return next(c)
-		}
-	}
+	return MiddlewareAuthenticators(AuthenticatorOIDC())
 }
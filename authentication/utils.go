@@ -3,6 +3,7 @@ package authentication
 import (
 	"log/slog"
 	"net/url"
+	"strings"
 )
 
 func slerr(err error) slog.Attr {
@@ -26,3 +27,20 @@ func cloneURL(u *url.URL) *url.URL {
 	return u2
 
 }
+
+// parseAuthorization splits an Authorization header into its scheme and credentials.
+// The scheme is returned in lower case.
+func parseAuthorization(header string) (scheme string, credentials string, ok bool) {
+
+	scheme, credentials, ok = strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return "", "", false
+	}
+
+	credentials = strings.TrimSpace(credentials)
+	if scheme == "" || credentials == "" {
+		return "", "", false
+	}
+
+	return strings.ToLower(scheme), credentials, true
+}
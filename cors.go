@@ -0,0 +1,49 @@
+package reverb
+
+import (
+	"errors"
+
+	"github.com/hcarriz/reverb/cors"
+)
+
+// Errors
+var (
+	ErrMissingCORS = errors.New("missing cors router")
+)
+
+// CORS applies the policies of the router to every route, see cors.Router for how a policy is chosen.
+// It must come before any CORSPolicy.
+func CORS(router *cors.Router) Option {
+	return option(func(c *config) error {
+
+		if router == nil {
+			return ErrMissingCORS
+		}
+
+		c.cors = router
+		c.echo.Use(router.Middleware())
+
+		return nil
+	})
+}
+
+// CORSPolicy registers the routes added by the options, i.e. Path or GraphQL, under the named policy of the router given to CORS.
+//
+//	reverb.CORSPolicy("spa", reverb.GraphQL("/graphql", true, srv))
+func CORSPolicy(name string, routes ...Option) Option {
+	return option(func(c *config) error {
+
+		if c.cors == nil {
+			return ErrMissingCORS
+		}
+
+		previous := c.policy
+		c.policy = name
+
+		defer func() {
+			c.policy = previous
+		}()
+
+		return Options(routes).apply(c)
+	})
+}
@@ -2,7 +2,8 @@ package cors
 
 import (
 	"errors"
-	"net/url"
+	"log/slog"
+	"regexp"
 	"slices"
 
 	"github.com/labstack/echo/v4"
@@ -10,13 +11,17 @@ import (
 )
 
 var (
-	ErrHasQuery          = errors.New("includes query")
-	ErrMissingScheme     = errors.New("missing scheme")
-	ErrHasPath           = errors.New("has path")
-	ErrInvalidHeader     = errors.New("invalid headers")
-	ErrOriginFuncDefined = errors.New("cors.OriginFunc has been used")
-	ErrOriginsDefined    = errors.New("cores.Origins has been users")
-	ErrInvalidAge        = errors.New("max age can not be negative")
+	ErrHasQuery            = errors.New("includes query")
+	ErrMissingScheme       = errors.New("missing scheme")
+	ErrHasPath             = errors.New("has path")
+	ErrInvalidHeader       = errors.New("invalid headers")
+	ErrOriginFuncDefined   = errors.New("cors.OriginFunc has been used")
+	ErrOriginsDefined      = errors.New("cores.Origins has been users")
+	ErrInvalidAge          = errors.New("max age can not be negative")
+	ErrInvalidPattern      = errors.New("invalid origin pattern")
+	ErrInvalidPortRange    = errors.New("invalid port range")
+	ErrWildcardCredentials = errors.New("the * origin can not be used with credentials")
+	ErrNilLogger           = errors.New("logger is nil")
 
 	AcceptableHeaders = []string{
 		echo.HeaderAccept,
@@ -70,24 +75,27 @@ var (
 )
 
 type Option interface {
-	apply(*middleware.CORSConfig) error
+	apply(*config) error
 }
 
-type option func(*middleware.CORSConfig) error
+type option func(*config) error
 
-func (o option) apply(c *middleware.CORSConfig) error {
+func (o option) apply(c *config) error {
 	return o(c)
 }
 
 func Skipper(skipper middleware.Skipper) Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 		c.Skipper = skipper
 		return nil
 	})
 }
 
+// Origins sets the origins that are allowed. Besides exact origins like "https://example.com", it accepts
+// wildcard subdomains like "https://*.example.com", which match any subdomain but not example.com itself,
+// and port ranges like "http://localhost:3000-3999" for local development.
 func Origins(list ...string) Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 
 		if c.AllowOriginFunc != nil {
 			return ErrOriginFuncDefined
@@ -96,27 +104,44 @@ func Origins(list ...string) Option {
 		for _, single := range list {
 
 			if single == "*" || single == "?" {
+				c.AllowOrigins = append(c.AllowOrigins, single)
 				continue
 			}
 
-			u, err := url.Parse(single)
+			r, err := parseOrigin(single)
 			if err != nil {
 				return err
 			}
 
-			// TODO: Add more checks.
-			switch {
-			case u.Query().Encode() != "":
-				return ErrHasQuery
-			case u.Path != "":
-				return ErrHasPath
-			case u.Scheme == "":
-				return ErrMissingScheme
+			if exact, ok := r.(exactRule); ok {
+				c.AllowOrigins = append(c.AllowOrigins, string(exact))
+				continue
 			}
 
+			c.rules = append(c.rules, r)
+		}
+
+		return nil
+	})
+}
+
+// OriginPatterns allows the origins that fully match any of the regular expressions, i.e. `https://pr-\d+\.preview\.example\.com`.
+func OriginPatterns(patterns ...string) Option {
+	return option(func(c *config) error {
+
+		if c.AllowOriginFunc != nil {
+			return ErrOriginFuncDefined
 		}
 
-		c.AllowOrigins = append(c.AllowOrigins, list...)
+		for _, pattern := range patterns {
+
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return errors.Join(ErrInvalidPattern, err)
+			}
+
+			c.rules = append(c.rules, regexpRule{re})
+		}
 
 		return nil
 	})
@@ -124,7 +149,7 @@ func Origins(list ...string) Option {
 
 // Headers is used to give the headers that are allowed, others are not allowed.
 func Headers(list ...string) Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 
 		for _, single := range list {
 			if !slices.Contains(AcceptableHeaders, single) {
@@ -140,9 +165,9 @@ func Headers(list ...string) Option {
 
 // OriginFunc allows for a function that checks the origin to be used by the CORS middleware.
 func OriginFunc(f func(origin string) (bool, error)) Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 
-		if len(c.AllowOrigins) > 0 {
+		if len(c.AllowOrigins) > 0 || len(c.rules) > 0 || c.store != nil {
 			return ErrOriginsDefined
 		}
 
@@ -153,7 +178,7 @@ func OriginFunc(f func(origin string) (bool, error)) Option {
 
 // Methods allows for certain methods to be allowed by the CORS middleware.
 func Methods(methods ...string) Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 
 		//TODO: check the methods to see if they're valid
 
@@ -165,14 +190,28 @@ func Methods(methods ...string) Option {
 
 // Credentials allows for credentials to be used.
 func Credentials() Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 		c.AllowCredentials = true
 		return nil
 	})
 }
 
+// Logger sets the logger for the errors of the Store, slog.Default by default.
+func Logger(logger *slog.Logger) Option {
+	return option(func(c *config) error {
+
+		if logger == nil {
+			return ErrNilLogger
+		}
+
+		c.logger = logger
+
+		return nil
+	})
+}
+
 func MaxAge(age int) Option {
-	return option(func(c *middleware.CORSConfig) error {
+	return option(func(c *config) error {
 		if age < 0 {
 			return ErrInvalidAge
 		}
@@ -183,19 +222,69 @@ func MaxAge(age int) Option {
 	})
 }
 
-func New(opts ...Option) (echo.MiddlewareFunc, error) {
+// config is the echo configuration, along with the origin rules it has no notion of.
+type config struct {
+	middleware.CORSConfig
+	rules  []rule
+	store  OriginStore
+	logger *slog.Logger
+}
 
-	config := middleware.CORSConfig{}
+func newConfig(opts ...Option) (*config, error) {
 
-	var err error
+	var (
+		err error
+		c   = &config{logger: slog.Default()}
+	)
 
 	for _, opt := range opts {
-		err = errors.Join(opt.apply(&config))
+		err = errors.Join(err, opt.apply(c))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// No origins at all means every origin, as with echo.
+	wildcard := slices.Contains(c.AllowOrigins, "*") || (len(c.AllowOrigins) == 0 && len(c.rules) == 0 && c.store == nil && c.AllowOriginFunc == nil)
+
+	if wildcard && c.AllowCredentials {
+		return nil, ErrWildcardCredentials
+	}
+
+	if len(c.rules) > 0 || c.store != nil {
+		c.AllowOriginFunc = c.allowed
+	}
+
+	return c, nil
+}
+
+// allowed checks the origin against the exact origins, the rules and then the store.
+func (c *config) allowed(origin string) (bool, error) {
+
+	if slices.Contains(c.AllowOrigins, origin) || slices.Contains(c.AllowOrigins, "*") {
+		return true, nil
+	}
+
+	for _, r := range c.rules {
+		if r.match(origin) {
+			return true, nil
+		}
 	}
 
+	if c.store != nil {
+		return c.lookup(origin)
+	}
+
+	return false, nil
+}
+
+func New(opts ...Option) (echo.MiddlewareFunc, error) {
+
+	c, err := newConfig(opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return middleware.CORSWithConfig(config), nil
+	return middleware.CORSWithConfig(c.CORSConfig), nil
 }
@@ -1,8 +1,11 @@
 package cors
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,6 +35,24 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "patterns",
+			args: []Option{
+				Origins("https://*.example.com", "http://localhost:3000-3999", "http://[::1]:8000-8100"),
+				OriginPatterns(`https://pr-\d+\.example\.dev`),
+				Credentials(),
+			},
+		},
+		{name: "query", args: []Option{Origins("https://example.com?a=b")}, wantErr: true},
+		{name: "missing scheme", args: []Option{Origins("example.com")}, wantErr: true},
+		{name: "wildcard top level domain", args: []Option{Origins("https://*.com")}, wantErr: true},
+		{name: "wildcard in the middle", args: []Option{Origins("https://api.*.example.com")}, wantErr: true},
+		{name: "reversed port range", args: []Option{Origins("http://localhost:4000-3000")}, wantErr: true},
+		{name: "port out of range", args: []Option{Origins("http://localhost:3000-70000")}, wantErr: true},
+		{name: "invalid regexp", args: []Option{OriginPatterns(`https://(`)}, wantErr: true},
+		{name: "wildcard with credentials", args: []Option{Origins("*"), Credentials()}, wantErr: true},
+		{name: "default with credentials", args: []Option{Credentials()}, wantErr: true},
+		{name: "origin func after patterns", args: []Option{Origins("https://*.example.com"), OriginFunc(func(string) (bool, error) { return true, nil })}, wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -48,3 +69,101 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestMatrix(t *testing.T) {
+
+	type want struct {
+		origin      string
+		credentials bool
+	}
+
+	policies := map[string][]Option{
+		"any": {
+			Origins("*"),
+		},
+		"spa": {
+			Origins("https://app.example.com", "https://*.example.com", "http://localhost:3000-3999"),
+			OriginPatterns(`https://pr-\d+\.preview\.example\.dev`),
+			Credentials(),
+			Methods(http.MethodGet, http.MethodPost),
+			Headers(echo.HeaderContentType),
+			MaxAge(600),
+		},
+	}
+
+	tests := []struct {
+		policy string
+		origin string
+		want   want
+	}{
+		{policy: "any", origin: "https://anything.test", want: want{origin: "*"}},
+		{policy: "spa", origin: "https://app.example.com", want: want{origin: "https://app.example.com", credentials: true}},
+		{policy: "spa", origin: "https://deep.tenant.example.com", want: want{origin: "https://deep.tenant.example.com", credentials: true}},
+		{policy: "spa", origin: "https://example.com"},
+		{policy: "spa", origin: "https://evilexample.com"},
+		{policy: "spa", origin: "https://example.com.evil.test"},
+		{policy: "spa", origin: "http://app.example.com"},
+		{policy: "spa", origin: "https://app.example.com:8443"},
+		{policy: "spa", origin: "http://localhost:3000", want: want{origin: "http://localhost:3000", credentials: true}},
+		{policy: "spa", origin: "http://localhost:3999", want: want{origin: "http://localhost:3999", credentials: true}},
+		{policy: "spa", origin: "http://localhost:4000"},
+		{policy: "spa", origin: "http://localhost"},
+		{policy: "spa", origin: "https://pr-42.preview.example.dev", want: want{origin: "https://pr-42.preview.example.dev", credentials: true}},
+		{policy: "spa", origin: "https://pr-42.preview.example.dev.evil.test"},
+		{policy: "spa", origin: "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.origin, func(t *testing.T) {
+
+			check := require.New(t)
+
+			mw, err := New(policies[tt.policy]...)
+			check.NoError(err)
+
+			e := echo.New()
+			e.Use(mw)
+			e.GET("/", func(c echo.Context) error {
+				return c.String(http.StatusOK, "ok")
+			})
+
+			// Preflight.
+			req := httptest.NewRequest(http.MethodOptions, "/", nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			check.Equal(http.StatusNoContent, rec.Code)
+			check.Equal(tt.want.origin, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			check.Contains(rec.Header().Values(echo.HeaderVary), echo.HeaderOrigin)
+
+			if tt.want.credentials {
+				check.Equal("true", rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+				check.Equal("GET,POST", rec.Header().Get(echo.HeaderAccessControlAllowMethods))
+				check.Equal(echo.HeaderContentType, rec.Header().Get(echo.HeaderAccessControlAllowHeaders))
+				check.Equal("600", rec.Header().Get(echo.HeaderAccessControlMaxAge))
+			} else {
+				check.Empty(rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+			}
+
+			if tt.want.origin == "" {
+				check.Empty(rec.Header().Get(echo.HeaderAccessControlAllowMethods))
+			}
+
+			// Actual request, which is always served, the browser decides based on the headers.
+			req = httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			rec = httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			check.Equal(http.StatusOK, rec.Code)
+			check.Equal(tt.want.origin, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			check.Equal(tt.want.credentials, rec.Header().Get(echo.HeaderAccessControlAllowCredentials) == "true")
+
+		})
+	}
+
+}
@@ -0,0 +1,153 @@
+package cors
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrEmptyPolicyName = errors.New("policy name is empty")
+	ErrPolicyDefined   = errors.New("policy has already been defined")
+	ErrUnknownPolicy   = errors.New("unknown policy")
+	ErrInvalidPrefix   = errors.New("path prefix must start with /")
+)
+
+type prefix struct {
+	path   string
+	policy string
+}
+
+// Router applies a different CORS policy depending on the request. A request uses the policy of its route,
+// then the policy of the longest matching path prefix, then the fallback. Requests without a policy get no CORS headers.
+//
+// Routes are matched with echo.Context.Path, so the router must be used with echo.Echo.Use and not echo.Echo.Pre.
+// Preflight requests resolve to the route they are asking about.
+type Router struct {
+	policies map[string]echo.MiddlewareFunc
+	routes   map[string]string
+	prefixes []prefix
+	fallback string
+}
+
+// NewRouter returns a Router without any policy.
+func NewRouter() *Router {
+	return &Router{
+		policies: make(map[string]echo.MiddlewareFunc),
+		routes:   make(map[string]string),
+	}
+}
+
+// Policy defines a named policy with the same options as New.
+func (r *Router) Policy(name string, opts ...Option) error {
+
+	if name == "" {
+		return ErrEmptyPolicyName
+	}
+
+	if _, ok := r.policies[name]; ok {
+		return ErrPolicyDefined
+	}
+
+	mw, err := New(opts...)
+	if err != nil {
+		return err
+	}
+
+	r.policies[name] = mw
+
+	return nil
+}
+
+// Prefix uses the policy for every path under path, i.e. "/api/public" matches "/api/public" and "/api/public/users" but not "/api/publication".
+func (r *Router) Prefix(path, policy string) error {
+
+	if !strings.HasPrefix(path, "/") {
+		return ErrInvalidPrefix
+	}
+
+	if err := r.known(policy); err != nil {
+		return err
+	}
+
+	r.prefixes = append(r.prefixes, prefix{path: strings.TrimSuffix(path, "/"), policy: policy})
+
+	// Longest prefixes are checked first.
+	sort.SliceStable(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].path) > len(r.prefixes[j].path)
+	})
+
+	return nil
+}
+
+// Route uses the policy for the route registered with path, as given to echo, i.e. "/users/:id".
+func (r *Router) Route(path, policy string) error {
+
+	if err := r.known(policy); err != nil {
+		return err
+	}
+
+	r.routes[path] = policy
+
+	return nil
+}
+
+// Fallback uses the policy for requests that match neither a route nor a prefix.
+func (r *Router) Fallback(policy string) error {
+
+	if err := r.known(policy); err != nil {
+		return err
+	}
+
+	r.fallback = policy
+
+	return nil
+}
+
+func (r *Router) known(policy string) error {
+
+	if policy == "" {
+		return ErrEmptyPolicyName
+	}
+
+	if _, ok := r.policies[policy]; !ok {
+		return ErrUnknownPolicy
+	}
+
+	return nil
+}
+
+// find returns the name of the policy for the request, or an empty string.
+func (r *Router) find(c echo.Context) string {
+
+	if policy, ok := r.routes[c.Path()]; ok {
+		return policy
+	}
+
+	path := c.Request().URL.Path
+
+	for _, p := range r.prefixes {
+		if path == p.path || strings.HasPrefix(path, p.path+"/") || p.path == "" {
+			return p.policy
+		}
+	}
+
+	return r.fallback
+}
+
+// Middleware returns the middleware that applies the policies.
+func (r *Router) Middleware() echo.MiddlewareFunc {
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			if mw, ok := r.policies[r.find(c)]; ok {
+				return mw(next)(c)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterErrors(t *testing.T) {
+
+	check := require.New(t)
+
+	r := NewRouter()
+
+	check.ErrorIs(r.Policy(""), ErrEmptyPolicyName)
+	check.ErrorIs(r.Policy("bad", Origins("example.com")), ErrMissingScheme)
+	check.NoError(r.Policy("public"))
+	check.ErrorIs(r.Policy("public"), ErrPolicyDefined)
+
+	check.ErrorIs(r.Prefix("api", "public"), ErrInvalidPrefix)
+	check.ErrorIs(r.Prefix("/api", "missing"), ErrUnknownPolicy)
+	check.ErrorIs(r.Route("/graphql", ""), ErrEmptyPolicyName)
+	check.ErrorIs(r.Fallback("missing"), ErrUnknownPolicy)
+}
+
+func TestRouter(t *testing.T) {
+
+	check := require.New(t)
+
+	r := NewRouter()
+	check.NoError(r.Policy("public", Methods(http.MethodGet)))
+	check.NoError(r.Policy("spa", Origins("https://app.example.com"), Credentials(), Methods(http.MethodGet, http.MethodPost)))
+	check.NoError(r.Policy("partner", Origins("https://partner.example.org")))
+	check.NoError(r.Prefix("/api/public", "public"))
+	check.NoError(r.Prefix("/api/public/partners/", "partner"))
+	check.NoError(r.Route("/graphql", "spa"))
+
+	e := echo.New()
+	e.Use(r.Middleware())
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/api/public/items", ok)
+	e.GET("/api/public/partners/feed", ok)
+	e.GET("/api/publication", ok)
+	e.POST("/graphql", ok)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		allowed     string
+		credentials bool
+	}{
+		{name: "public", method: http.MethodGet, path: "/api/public/items", origin: "https://anyone.test", allowed: "*"},
+		{name: "longest prefix", method: http.MethodGet, path: "/api/public/partners/feed", origin: "https://partner.example.org", allowed: "https://partner.example.org"},
+		{name: "longest prefix rejects", method: http.MethodGet, path: "/api/public/partners/feed", origin: "https://anyone.test"},
+		{name: "prefix boundary", method: http.MethodGet, path: "/api/publication", origin: "https://anyone.test"},
+		{name: "route", method: http.MethodPost, path: "/graphql", origin: "https://app.example.com", allowed: "https://app.example.com", credentials: true},
+		{name: "route rejects", method: http.MethodPost, path: "/graphql", origin: "https://anyone.test"},
+		{name: "route preflight", method: http.MethodOptions, path: "/graphql", origin: "https://app.example.com", allowed: "https://app.example.com", credentials: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+
+			if tt.method == http.MethodOptions {
+				req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			check.Equal(tt.allowed, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			check.Equal(tt.credentials, rec.Header().Get(echo.HeaderAccessControlAllowCredentials) == "true")
+		})
+	}
+
+	// The fallback covers everything else.
+	check.NoError(r.Fallback("public"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/publication", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://anyone.test")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal("*", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+}
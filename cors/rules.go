@@ -0,0 +1,150 @@
+package cors
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rule is an origin that is not a single exact value.
+type rule interface {
+	match(origin string) bool
+}
+
+type exactRule string
+
+func (r exactRule) match(origin string) bool {
+	return string(r) == origin
+}
+
+// subdomainRule matches any subdomain of domain, at any depth.
+type subdomainRule struct {
+	scheme string
+	domain string
+	port   string
+}
+
+func (r subdomainRule) match(origin string) bool {
+
+	scheme, host, port, ok := splitOrigin(origin)
+	if !ok || scheme != r.scheme || port != r.port {
+		return false
+	}
+
+	sub, found := strings.CutSuffix(host, "."+r.domain)
+
+	return found && sub != "" && !strings.HasSuffix(sub, ".")
+}
+
+type portRangeRule struct {
+	scheme string
+	host   string
+	low    int
+	high   int
+}
+
+func (r portRangeRule) match(origin string) bool {
+
+	scheme, host, port, ok := splitOrigin(origin)
+	if !ok || scheme != r.scheme || host != r.host {
+		return false
+	}
+
+	n, err := strconv.Atoi(port)
+
+	return err == nil && n >= r.low && n <= r.high
+}
+
+type regexpRule struct {
+	re *regexp.Regexp
+}
+
+func (r regexpRule) match(origin string) bool {
+	// Long origins are not real ones, there is no need to run the expression on them.
+	return len(origin) <= 253+len("https://")+len(":65535") && r.re.MatchString(origin)
+}
+
+// splitOrigin splits a serialized origin as sent by browsers, i.e. "https://example.com:8443".
+func splitOrigin(origin string) (scheme, host, port string, ok bool) {
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return "", "", "", false
+	}
+
+	return u.Scheme, strings.ToLower(u.Hostname()), u.Port(), true
+}
+
+// parseOrigin validates an origin given to Origins, returning the rule that matches it.
+func parseOrigin(origin string) (rule, error) {
+
+	scheme, rest, ok := strings.Cut(origin, "://")
+	if !ok || scheme == "" {
+		return nil, ErrMissingScheme
+	}
+
+	if strings.ContainsAny(rest, "?") {
+		return nil, ErrHasQuery
+	}
+
+	if strings.ContainsAny(rest, "/#") {
+		return nil, ErrHasPath
+	}
+
+	host, port := rest, ""
+
+	if strings.LastIndex(rest, ":") > strings.LastIndex(rest, "]") {
+
+		var err error
+
+		host, port, err = net.SplitHostPort(rest)
+		if err != nil {
+			return nil, ErrInvalidPattern
+		}
+	}
+
+	if host == "" {
+		return nil, ErrInvalidPattern
+	}
+
+	scheme, host = strings.ToLower(scheme), strings.ToLower(host)
+
+	if low, high, isRange := strings.Cut(port, "-"); isRange {
+
+		if strings.Contains(host, "*") {
+			return nil, ErrInvalidPattern
+		}
+
+		l, errLow := strconv.Atoi(low)
+		h, errHigh := strconv.Atoi(high)
+
+		if errLow != nil || errHigh != nil || l < 1 || h > 65535 || l > h {
+			return nil, ErrInvalidPortRange
+		}
+
+		return portRangeRule{scheme: scheme, host: strings.Trim(host, "[]"), low: l, high: h}, nil
+	}
+
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, ErrInvalidPattern
+		}
+	}
+
+	if domain, ok := strings.CutPrefix(host, "*."); ok {
+
+		if domain == "" || strings.Contains(domain, "*") || !strings.Contains(domain, ".") && domain != "localhost" {
+			return nil, ErrInvalidPattern
+		}
+
+		return subdomainRule{scheme: scheme, domain: domain, port: port}, nil
+	}
+
+	if strings.Contains(host, "*") {
+		return nil, ErrInvalidPattern
+	}
+
+	return exactRule(strings.ToLower(origin)), nil
+}
@@ -0,0 +1,236 @@
+package cors
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrNilOriginStore = errors.New("origin store is nil")
+	ErrInvalidTTL     = errors.New("cache durations can not be negative")
+)
+
+// lookupTimeout bounds a single call to an OriginStore, echo does not give the request context to the origin check.
+const lookupTimeout = 3 * time.Second
+
+// maxCached bounds how many origins are cached, as anyone can send any origin.
+// Past it the least recently used origins are evicted.
+const maxCached = 10_000
+
+// OriginStore decides at runtime if an origin is allowed, i.e. from the domains tenants registered in the database.
+// Origins are given in lower case.
+type OriginStore interface {
+	AllowedOrigin(ctx context.Context, origin string) (bool, error)
+}
+
+// OriginStoreFunc is an adapter to use a function as an OriginStore.
+type OriginStoreFunc func(ctx context.Context, origin string) (bool, error)
+
+func (f OriginStoreFunc) AllowedOrigin(ctx context.Context, origin string) (bool, error) {
+	return f(ctx, origin)
+}
+
+type cached struct {
+	origin  string
+	allowed bool
+	expires time.Time
+}
+
+// OriginCache remembers the answers of an OriginStore, allowed origins for ttl and rejected ones for negative.
+// Errors are not cached. Concurrent lookups of the same origin reach the store once.
+type OriginCache struct {
+	store    OriginStore
+	ttl      time.Duration
+	negative time.Duration
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // The front is the most recently used.
+	group    singleflight.Group
+	now      func() time.Time
+	// epoch is bumped by Forget, lookups that started before it do not cache their answer.
+	epoch uint64
+}
+
+// NewOriginCache caches the answers of store. A duration of zero disables caching for those answers.
+func NewOriginCache(store OriginStore, ttl, negative time.Duration) (*OriginCache, error) {
+
+	if store == nil {
+		return nil, ErrNilOriginStore
+	}
+
+	if ttl < 0 || negative < 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	return &OriginCache{
+		store:    store,
+		ttl:      ttl,
+		negative: negative,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}, nil
+}
+
+// AllowedOrigin returns the cached answer for origin, asking the store when there is none.
+// The store is asked within lookupTimeout whatever ctx is, as other callers may be waiting for the same answer,
+// and this caller stops waiting when ctx is done.
+func (o *OriginCache) AllowedOrigin(ctx context.Context, origin string) (bool, error) {
+
+	origin = strings.ToLower(origin)
+
+	if allowed, ok := o.cached(origin); ok {
+		return allowed, nil
+	}
+
+	result := o.group.DoChan(origin, func() (any, error) {
+
+		o.mu.Lock()
+		epoch := o.epoch
+		o.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+		defer cancel()
+
+		allowed, err := o.store.AllowedOrigin(ctx, origin)
+		if err != nil {
+			return false, err
+		}
+
+		o.remember(origin, allowed, epoch)
+
+		return allowed, nil
+	})
+
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return false, r.Err
+		}
+		return r.Val.(bool), nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// cached returns the answer for origin when it has not expired.
+func (o *OriginCache) cached(origin string) (bool, bool) {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	el, ok := o.entries[origin]
+	if !ok {
+		return false, false
+	}
+
+	entry := el.Value.(*cached)
+
+	if !o.now().Before(entry.expires) {
+		o.order.Remove(el)
+		delete(o.entries, origin)
+		return false, false
+	}
+
+	o.order.MoveToFront(el)
+
+	return entry.allowed, true
+}
+
+// Forget drops the cached answer for origin, so a domain that was just registered is allowed right away.
+// Answers of lookups already in flight are not cached, and later callers do not wait for them.
+func (o *OriginCache) Forget(origin string) {
+
+	origin = strings.ToLower(origin)
+
+	o.group.Forget(origin)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.epoch++
+
+	if el, ok := o.entries[origin]; ok {
+		o.order.Remove(el)
+		delete(o.entries, el.Value.(*cached).origin)
+	}
+}
+
+// remember caches the answer of a lookup that started at epoch, unless Forget was called since.
+func (o *OriginCache) remember(origin string, allowed bool, epoch uint64) {
+
+	ttl := o.negative
+	if allowed {
+		ttl = o.ttl
+	}
+
+	if ttl == 0 {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.epoch != epoch {
+		return
+	}
+
+	entry := &cached{origin: origin, allowed: allowed, expires: o.now().Add(ttl)}
+
+	if el, ok := o.entries[origin]; ok {
+		el.Value = entry
+		o.order.MoveToFront(el)
+		return
+	}
+
+	o.entries[origin] = o.order.PushFront(entry)
+
+	for len(o.entries) > maxCached {
+		oldest := o.order.Back()
+		o.order.Remove(oldest)
+		delete(o.entries, oldest.Value.(*cached).origin)
+	}
+}
+
+// Store allows the origins that store allows, on top of the ones given to Origins and OriginPatterns.
+// Wrap the store with NewOriginCache unless it is cheap to call on every cross origin request.
+// When the store fails the origin is rejected and the error logged, see Logger.
+func Store(store OriginStore) Option {
+	return option(func(c *config) error {
+
+		if store == nil {
+			return ErrNilOriginStore
+		}
+
+		if c.AllowOriginFunc != nil {
+			return ErrOriginFuncDefined
+		}
+
+		c.store = store
+
+		return nil
+	})
+}
+
+// lookup asks the store about origin. A failing store rejects the origin instead of failing the request,
+// which would turn an outage of the store into errors on every cross origin request.
+func (c *config) lookup(origin string) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	allowed, err := c.store.AllowedOrigin(ctx, strings.ToLower(origin))
+	if err != nil {
+		c.logger.LogAttrs(ctx, slog.LevelError, "unable to check origin, rejecting it", slog.String("origin", origin), slog.String("error", err.Error()))
+		return false, nil
+	}
+
+	return allowed, nil
+}
@@ -0,0 +1,321 @@
+package cors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type tenants struct {
+	mu      sync.Mutex
+	origins map[string]bool
+	calls   map[string]int
+	err     error
+}
+
+func (t *tenants) AllowedOrigin(_ context.Context, origin string) (bool, error) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.calls[origin]++
+
+	return t.origins[origin], t.err
+}
+
+func TestOriginCache(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := NewOriginCache(nil, time.Minute, time.Second)
+	check.ErrorIs(err, ErrNilOriginStore)
+
+	_, err = NewOriginCache(&tenants{}, -time.Minute, time.Second)
+	check.ErrorIs(err, ErrInvalidTTL)
+
+	store := &tenants{origins: map[string]bool{"https://tenant.example.com": true}, calls: map[string]int{}}
+
+	cache, err := NewOriginCache(store, time.Minute, 10*time.Second)
+	check.NoError(err)
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	allowed, err := cache.AllowedOrigin(ctx, "https://Tenant.example.com")
+	check.NoError(err)
+	check.True(allowed)
+
+	allowed, err = cache.AllowedOrigin(ctx, "https://other.example.com")
+	check.NoError(err)
+	check.False(allowed)
+
+	// Both answers are cached.
+	for x := 0; x < 3; x++ {
+		_, _ = cache.AllowedOrigin(ctx, "https://tenant.example.com")
+		_, _ = cache.AllowedOrigin(ctx, "https://other.example.com")
+	}
+
+	check.Equal(1, store.calls["https://tenant.example.com"])
+	check.Equal(1, store.calls["https://other.example.com"])
+
+	// A newly registered origin is seen once the negative answer expires.
+	store.origins["https://other.example.com"] = true
+
+	now = now.Add(10 * time.Second)
+
+	allowed, err = cache.AllowedOrigin(ctx, "https://other.example.com")
+	check.NoError(err)
+	check.True(allowed)
+	check.Equal(2, store.calls["https://other.example.com"])
+
+	// Or right away when forgotten.
+	delete(store.origins, "https://tenant.example.com")
+	cache.Forget("https://tenant.example.com")
+
+	allowed, err = cache.AllowedOrigin(ctx, "https://tenant.example.com")
+	check.NoError(err)
+	check.False(allowed)
+
+	// Errors are not cached.
+	store.err = errors.New("database is down")
+
+	_, err = cache.AllowedOrigin(ctx, "https://down.example.com")
+	check.ErrorIs(err, store.err)
+
+	store.err = nil
+
+	_, err = cache.AllowedOrigin(ctx, "https://down.example.com")
+	check.NoError(err)
+	check.Equal(2, store.calls["https://down.example.com"])
+}
+
+func TestOriginCacheBounded(t *testing.T) {
+
+	check := require.New(t)
+
+	cache, err := NewOriginCache(OriginStoreFunc(func(context.Context, string) (bool, error) {
+		return false, nil
+	}), time.Minute, time.Minute)
+	check.NoError(err)
+
+	cache.remember("https://kept.example.com", true, 0)
+
+	for x := 0; x < maxCached-1; x++ {
+		cache.remember(fmt.Sprintf("https://%d.example.com", x), false, 0)
+	}
+
+	// Using an origin keeps it when the cache is full.
+	_, ok := cache.cached("https://kept.example.com")
+	check.True(ok)
+
+	for x := maxCached; x < maxCached+10; x++ {
+		cache.remember(fmt.Sprintf("https://%d.example.com", x), false, 0)
+	}
+
+	check.Len(cache.entries, maxCached)
+	check.Equal(maxCached, cache.order.Len())
+
+	allowed, ok := cache.cached("https://kept.example.com")
+	check.True(ok)
+	check.True(allowed)
+
+	// The least recently used ones were evicted, not everything.
+	_, ok = cache.cached("https://0.example.com")
+	check.False(ok)
+
+	_, ok = cache.cached("https://10.example.com")
+	check.True(ok)
+}
+
+func TestOriginCacheDeadline(t *testing.T) {
+
+	check := require.New(t)
+
+	var (
+		calls   atomic.Int32
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	cache, err := NewOriginCache(OriginStoreFunc(func(ctx context.Context, _ string) (bool, error) {
+
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+
+		select {
+		case <-release:
+			return true, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}), time.Minute, time.Minute)
+	check.NoError(err)
+
+	// The first caller gives up quickly.
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.AllowedOrigin(short, "https://tenant.example.com")
+		first <- err
+	}()
+
+	<-started
+
+	second := make(chan bool, 1)
+	go func() {
+		allowed, _ := cache.AllowedOrigin(context.Background(), "https://tenant.example.com")
+		second <- allowed
+	}()
+
+	check.ErrorIs(<-first, context.DeadlineExceeded)
+
+	// The lookup was not cancelled with the first caller, the second one gets the answer.
+	close(release)
+
+	check.True(<-second)
+	check.EqualValues(1, calls.Load())
+}
+
+func TestOriginCacheForgetInFlight(t *testing.T) {
+
+	check := require.New(t)
+
+	var (
+		mu      sync.Mutex
+		allowed = true
+		calls   atomic.Int32
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	cache, err := NewOriginCache(OriginStoreFunc(func(context.Context, string) (bool, error) {
+
+		mu.Lock()
+		answer := allowed
+		mu.Unlock()
+
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+
+		return answer, nil
+	}), time.Minute, time.Minute)
+	check.NoError(err)
+
+	stale := make(chan bool, 1)
+	go func() {
+		answer, _ := cache.AllowedOrigin(context.Background(), "https://tenant.example.com")
+		stale <- answer
+	}()
+
+	<-started
+
+	// The origin is revoked while the lookup is blocked.
+	mu.Lock()
+	allowed = false
+	mu.Unlock()
+
+	cache.Forget("https://tenant.example.com")
+
+	// Callers after Forget do not wait for the stale lookup.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	answer, err := cache.AllowedOrigin(ctx, "https://tenant.example.com")
+	check.NoError(err)
+	check.False(answer)
+
+	close(release)
+	check.True(<-stale)
+
+	// The stale answer was not cached over the new one.
+	answer, err = cache.AllowedOrigin(context.Background(), "https://tenant.example.com")
+	check.NoError(err)
+	check.False(answer)
+	check.EqualValues(2, calls.Load())
+}
+
+func TestStore(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(Store(nil))
+	check.ErrorIs(err, ErrNilOriginStore)
+
+	store := &tenants{origins: map[string]bool{"https://tenant.example.com": true}, calls: map[string]int{}}
+
+	_, err = New(Store(store), OriginFunc(func(string) (bool, error) { return true, nil }))
+	check.ErrorIs(err, ErrOriginsDefined)
+
+	mw, err := New(Origins("https://app.example.com"), Store(store), Credentials())
+	check.NoError(err)
+
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for origin, want := range map[string]string{
+		"https://app.example.com":    "https://app.example.com",
+		"https://tenant.example.com": "https://tenant.example.com",
+		"https://evil.test":          "",
+	} {
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderOrigin, origin)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		check.Equal(http.StatusOK, rec.Code)
+		check.Equal(want, rec.Header().Get(echo.HeaderAccessControlAllowOrigin), origin)
+	}
+
+	// Static origins never reach the store.
+	check.Zero(store.calls["https://app.example.com"])
+
+	// A failing store rejects the origin and logs why, the request itself is served.
+	var buf bytes.Buffer
+
+	mw, err = New(Store(store), Credentials(), Logger(slog.New(slog.NewTextHandler(&buf, nil))))
+	check.NoError(err)
+
+	e = echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	store.err = errors.New("database is down")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://tenant.example.com")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	check.Equal(http.StatusOK, rec.Code)
+	check.Empty(rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	check.Contains(buf.String(), "database is down")
+
+	_, err = New(Logger(nil))
+	check.ErrorIs(err, ErrNilLogger)
+}
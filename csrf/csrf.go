@@ -0,0 +1,340 @@
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hcarriz/reverb/renderer"
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var (
+	ErrSkipperNil    = errors.New("skipper is nil")
+	ErrSessionIsNil  = errors.New("session is nil")
+	ErrEmptyArgument = errors.New("argument can not be empty")
+	ErrInvalidLength = errors.New("token length must be at least 16")
+	ErrInvalidToken  = echo.NewHTTPError(http.StatusForbidden, "invalid csrf token")
+)
+
+const (
+	// ContextKey is the key the token is stored under in the echo.Context.
+	ContextKey = "csrf"
+
+	fieldKey = "csrf_field"
+
+	DefaultHeader    = echo.HeaderXCSRFToken
+	DefaultFormField = "csrf_token"
+	DefaultCookie    = "_csrf"
+	DefaultKey       = "csrf_token"
+)
+
+// Session is where synchronizer tokens are kept. *scs.SessionManager satisfies it.
+type Session interface {
+	GetString(ctx context.Context, key string) string
+	Put(ctx context.Context, key string, val any)
+}
+
+type config struct {
+	skipper      middleware.Skipper
+	session      Session
+	key          string
+	header       string
+	field        string
+	length       int
+	exemptBearer bool
+	cookie       http.Cookie
+}
+
+type Option interface {
+	apply(*config) error
+}
+
+type option func(*config) error
+
+func (o option) apply(c *config) error {
+	return o(c)
+}
+
+// Skipper lets you use the skipper of your choice.
+func Skipper(sk middleware.Skipper) Option {
+	return option(func(c *config) error {
+
+		if sk == nil {
+			return ErrSkipperNil
+		}
+
+		c.skipper = sk
+
+		return nil
+	})
+}
+
+// SessionStore uses synchronizer tokens kept in the session under key.
+// The session must already be loaded, i.e. by the scs LoadAndSave middleware.
+func SessionStore(session Session, key string) Option {
+	return option(func(c *config) error {
+
+		if session == nil {
+			return ErrSessionIsNil
+		}
+
+		if key == "" {
+			key = DefaultKey
+		}
+
+		c.session = session
+		c.key = key
+
+		return nil
+	})
+}
+
+// DoubleSubmit uses a token kept in a cookie with the given name instead of the session.
+// This is the default when SessionStore is not used.
+func DoubleSubmit(name string) Option {
+	return option(func(c *config) error {
+
+		if name == "" {
+			return ErrEmptyArgument
+		}
+
+		c.session = nil
+		c.cookie.Name = name
+
+		return nil
+	})
+}
+
+// Cookie sets the attributes of the double submit cookie.
+func Cookie(path, domain string, secure bool, sameSite http.SameSite) Option {
+	return option(func(c *config) error {
+		c.cookie.Path = path
+		c.cookie.Domain = domain
+		c.cookie.Secure = secure
+		c.cookie.SameSite = sameSite
+		return nil
+	})
+}
+
+// Header sets the request header that the token is read from.
+func Header(name string) Option {
+	return option(func(c *config) error {
+
+		if name == "" {
+			return ErrEmptyArgument
+		}
+
+		c.header = name
+
+		return nil
+	})
+}
+
+// FormField sets the form field that the token is read from when the header is missing.
+func FormField(name string) Option {
+	return option(func(c *config) error {
+
+		if name == "" {
+			return ErrEmptyArgument
+		}
+
+		c.field = name
+
+		return nil
+	})
+}
+
+// TokenLength sets the amount of random bytes in a token.
+func TokenLength(length int) Option {
+	return option(func(c *config) error {
+
+		if length < 16 {
+			return ErrInvalidLength
+		}
+
+		c.length = length
+
+		return nil
+	})
+}
+
+// CheckBearer also checks requests authenticated by a bearer token. By default they are exempt,
+// as browsers do not attach the Authorization header on their own, nor let another site set it without CORS.
+// Requests marked with viewer.SetBearer, as authentication.AuthenticatorBearerToken does on success, are exempt,
+// and so are requests with a bearer Authorization header that nothing authenticated yet, i.e. when the
+// authentication runs after csrf, as in the routes of the authentication package.
+func CheckBearer() Option {
+	return option(func(c *config) error {
+		c.exemptBearer = false
+		return nil
+	})
+}
+
+// New returns a middleware that protects unsafe methods against cross site request forgery.
+// Handlers and templates can get the token with Token and Field.
+func New(opts ...Option) (echo.MiddlewareFunc, error) {
+
+	var (
+		err error
+		c   = config{
+			skipper:      middleware.DefaultSkipper,
+			header:       DefaultHeader,
+			field:        DefaultFormField,
+			length:       32,
+			exemptBearer: true,
+			// The cookie is readable by scripts so that they can copy it into the header.
+			cookie: http.Cookie{
+				Name:     DefaultCookie,
+				Path:     "/",
+				SameSite: http.SameSiteLaxMode,
+			},
+		}
+	)
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(&c))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+
+			if c.skipper(ctx) {
+				return next(ctx)
+			}
+
+			if c.exemptBearer && bearer(ctx.Request()) {
+				return next(ctx)
+			}
+
+			token, err := c.token(ctx)
+			if err != nil {
+				return err
+			}
+
+			ctx.Set(ContextKey, token)
+			ctx.Set(fieldKey, c.field)
+
+			if slices.Contains([]string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}, ctx.Request().Method) {
+				return next(ctx)
+			}
+
+			submitted := ctx.Request().Header.Get(c.header)
+			if submitted == "" {
+				submitted = ctx.FormValue(c.field)
+			}
+
+			if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				return ErrInvalidToken
+			}
+
+			return next(ctx)
+		}
+	}, nil
+}
+
+// token returns the existing token for the request, creating one if needed.
+func (c *config) token(ctx echo.Context) (string, error) {
+
+	if c.session != nil {
+
+		if token := c.session.GetString(ctx.Request().Context(), c.key); token != "" {
+			return token, nil
+		}
+
+		token, err := generate(c.length)
+		if err != nil {
+			return "", err
+		}
+
+		c.session.Put(ctx.Request().Context(), c.key, token)
+
+		return token, nil
+	}
+
+	if cookie, err := ctx.Cookie(c.cookie.Name); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	token, err := generate(c.length)
+	if err != nil {
+		return "", err
+	}
+
+	cookie := c.cookie
+	cookie.Value = token
+
+	ctx.SetCookie(&cookie)
+
+	return token, nil
+}
+
+func generate(length int) (string, error) {
+
+	b := make([]byte, length)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Token returns the token for the request, or an empty string if the middleware did not run.
+func Token(c echo.Context) string {
+
+	if token, ok := c.Get(ContextKey).(string); ok {
+		return token
+	}
+
+	return ""
+}
+
+// Field returns a hidden form input holding the token for the request.
+func Field(c echo.Context) template.HTML {
+
+	field, ok := c.Get(fieldKey).(string)
+	if !ok {
+		field = DefaultFormField
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, template.HTMLEscapeString(field), template.HTMLEscapeString(Token(c))))
+}
+
+// Renderer adds csrfToken and csrfField to the templates of the renderer package.
+func Renderer() renderer.Option {
+	return renderer.Options{
+		renderer.ContextFunc("csrfToken", func(c echo.Context) any { return Token(c) }),
+		renderer.ContextFunc("csrfField", func(c echo.Context) any { return Field(c) }),
+	}
+}
+
+// bearer reports if the request was authenticated by a bearer token, or has one and was not authenticated otherwise.
+// Requests that fell back to a session, with an unknown token, are not exempt.
+func bearer(r *http.Request) bool {
+
+	if viewer.IsBearer(r.Context()) {
+		return true
+	}
+
+	if _, ok := viewer.GetUserID[string](r.Context()); ok {
+		return false
+	}
+
+	scheme, credentials, ok := strings.Cut(strings.TrimSpace(r.Header.Get(echo.HeaderAuthorization)), " ")
+
+	return ok && strings.EqualFold(scheme, "bearer") && strings.TrimSpace(credentials) != ""
+}
@@ -0,0 +1,242 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/renderer"
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/labstack/echo/v4"
+	session "github.com/spazzymoto/echo-scs-session"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		args    []Option
+		wantErr error
+	}{
+		{name: "default"},
+		{name: "nil skipper", args: []Option{Skipper(nil)}, wantErr: ErrSkipperNil},
+		{name: "nil session", args: []Option{SessionStore(nil, "")}, wantErr: ErrSessionIsNil},
+		{name: "short token", args: []Option{TokenLength(8)}, wantErr: ErrInvalidLength},
+		{name: "empty header", args: []Option{Header("")}, wantErr: ErrEmptyArgument},
+		{name: "empty field", args: []Option{FormField("")}, wantErr: ErrEmptyArgument},
+		{name: "empty cookie", args: []Option{DoubleSubmit("")}, wantErr: ErrEmptyArgument},
+		{name: "session", args: []Option{SessionStore(scs.New(), ""), CheckBearer(), TokenLength(16)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			_, err := New(tt.args...)
+			if tt.wantErr != nil {
+				check.ErrorIs(err, tt.wantErr)
+			} else {
+				check.NoError(err)
+			}
+
+		})
+	}
+}
+
+func server(t *testing.T, sm *scs.SessionManager, opts ...Option) *echo.Echo {
+
+	check := require.New(t)
+
+	mw, err := New(opts...)
+	check.NoError(err)
+
+	e := echo.New()
+
+	if sm != nil {
+		e.Use(session.LoadAndSave(sm))
+	}
+
+	// Only the "valid" bearer token authenticates, like authentication.AuthenticatorBearerToken.
+	// Other tokens fall back to the session, like the chain of the authentication package.
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch {
+			case c.Request().Header.Get(echo.HeaderAuthorization) == "Bearer valid":
+				c.SetRequest(c.Request().WithContext(viewer.SetBearer(c.Request().Context())))
+			case c.Request().Header.Get(echo.HeaderAuthorization) == "Bearer invalid" && len(c.Request().Cookies()) > 0:
+				c.SetRequest(c.Request().WithContext(viewer.SetUserID(c.Request().Context(), "from_session")))
+			}
+			return next(c)
+		}
+	})
+
+	e.Use(mw)
+
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, Token(c))
+	})
+
+	e.POST("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	return e
+}
+
+func TestSynchronizer(t *testing.T) {
+
+	check := require.New(t)
+
+	sm := scs.New()
+
+	e := server(t, sm, SessionStore(sm, ""))
+
+	// Get a token.
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	check.Equal(http.StatusOK, rec.Code)
+
+	token := rec.Body.String()
+	check.NotEmpty(token)
+
+	cookies := rec.Result().Cookies()
+	check.Len(cookies, 1)
+	check.Equal(sm.Cookie.Name, cookies[0].Name)
+
+	// The token is kept for the session.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(token, rec.Body.String())
+
+	tests := []struct {
+		name   string
+		header string
+		form   string
+		cookie bool
+		bearer string
+		status int
+	}{
+		{name: "header", header: token, cookie: true, status: http.StatusNoContent},
+		{name: "form", form: token, cookie: true, status: http.StatusNoContent},
+		{name: "missing", cookie: true, status: http.StatusForbidden},
+		{name: "wrong", header: "wrong", cookie: true, status: http.StatusForbidden},
+		{name: "without session", header: token, status: http.StatusForbidden},
+		{name: "bearer", bearer: "valid", status: http.StatusNoContent},
+		{name: "invalid bearer", bearer: "invalid", cookie: true, status: http.StatusForbidden},
+		{name: "bearer not authenticated yet", bearer: "later", status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			var body *strings.Reader
+
+			if tt.form != "" {
+				body = strings.NewReader(url.Values{DefaultFormField: {tt.form}}.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+
+			if tt.form != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			}
+
+			if tt.header != "" {
+				req.Header.Set(DefaultHeader, tt.header)
+			}
+
+			if tt.cookie {
+				req.AddCookie(cookies[0])
+			}
+
+			if tt.bearer != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.bearer)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			check.Equal(tt.status, rec.Code)
+		})
+	}
+
+}
+
+func TestDoubleSubmit(t *testing.T) {
+
+	check := require.New(t)
+
+	e := server(t, nil, CheckBearer())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	check.Equal(http.StatusOK, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	check.Len(cookies, 1)
+	check.Equal(DefaultCookie, cookies[0].Name)
+	check.Equal(rec.Body.String(), cookies[0].Value)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookies[0])
+	req.Header.Set(DefaultHeader, cookies[0].Value)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusNoContent, rec.Code)
+
+	// The header must match the cookie.
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookies[0])
+	req.Header.Set(DefaultHeader, "wrong")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusForbidden, rec.Code)
+
+	// Bearer requests are checked when asked to.
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer valid")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusForbidden, rec.Code)
+
+}
+
+func TestRenderer(t *testing.T) {
+
+	check := require.New(t)
+
+	mw, err := New(FormField("token"))
+	check.NoError(err)
+
+	r, err := renderer.New(fstest.MapFS{
+		"form.html": {Data: []byte(`{{ csrfToken }}|{{ csrfField }}`)},
+	}, renderer.AddFiles("form.html"), Renderer())
+	check.NoError(err)
+
+	e := echo.New()
+	e.Renderer = r
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "form.html", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	check.Equal(http.StatusOK, rec.Code)
+
+	token := rec.Result().Cookies()[0].Value
+	check.Equal(token+`|<input type="hidden" name="token" value="`+token+`">`, rec.Body.String())
+
+}
@@ -3,8 +3,11 @@ package graceful
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -12,15 +15,25 @@ import (
 )
 
 var (
-	ErrInvalidDuration = errors.New("invalid duration")
-	ErrExistingAddress = errors.New("the address has already been set")
-	ErrInvalidAddr     = errors.New("invalid address")
-	ErrMissingServices = errors.New("missing services")
+	ErrInvalidDuration  = errors.New("invalid duration")
+	ErrExistingAddress  = errors.New("the address has already been set")
+	ErrInvalidAddr      = errors.New("invalid address")
+	ErrMissingServices  = errors.New("missing services")
+	ErrMissingSignals   = errors.New("missing signals")
+	ErrInvalidService   = errors.New("services need both Start and Close")
+	ErrTimeout          = errors.New("services did not stop before the timeout")
+	ErrMissingListeners = errors.New("missing listeners")
+	ErrSignalOverlap    = errors.New("a signal is used for more than one of shutdown, reload and handoff")
 )
 
 type config struct {
-	timeout time.Duration
-	logger  Log
+	timeout   time.Duration
+	logger    Log
+	signals   []os.Signal
+	listeners *Listeners
+	handoff   []os.Signal
+	reloaders []reloader
+	reload    []os.Signal
 }
 
 type Log interface {
@@ -50,6 +63,47 @@ func Timeout(duration time.Duration) Option {
 	})
 }
 
+// Signals sets the signals that start the shutdown, the default is os.Interrupt and syscall.SIGTERM.
+func Signals(signals ...os.Signal) Option {
+	return option(func(c *config) error {
+
+		if len(signals) < 1 {
+			return ErrMissingSignals
+		}
+
+		c.signals = signals
+
+		return nil
+	})
+}
+
+// Handoff makes Run start a new process with Listeners.Upgrade when one of the signals is received, syscall.SIGUSR2 by default,
+// then shut down while the new process accepts the connections. If the upgrade fails Run keeps going.
+// Handing off is only supported on unix, elsewhere Handoff returns ErrHandoffSupport.
+// There is no readiness handshake, the shutdown starts as soon as the new process is started, so check
+// the configuration before sending the signal; a new process that fails at startup leaves nothing serving.
+func Handoff(listeners *Listeners, signals ...os.Signal) Option {
+	return option(func(c *config) error {
+
+		if listeners == nil {
+			return ErrMissingListeners
+		}
+
+		if len(defaultHandoff) < 1 {
+			return ErrHandoffSupport
+		}
+
+		if len(signals) < 1 {
+			signals = defaultHandoff
+		}
+
+		c.listeners = listeners
+		c.handoff = signals
+
+		return nil
+	})
+}
+
 func Logger(logger Log) Option {
 	return option(func(c *config) error {
 		c.logger = logger
@@ -57,9 +111,21 @@ func Logger(logger Log) Option {
 	})
 }
 
+// Service is something to start and close, like an http.Server.
 type Service struct {
+	// Name identifies the service in the logs and in DependsOn.
+	Name string
+	// Start runs the service and must block until Close is called, like http.Server.ListenAndServe.
+	// When every Start has returned there is nothing left to run, and Run shuts down.
 	Start func() error
 	Close func(context.Context) error
+	// DependsOn names the services that must stay up until this one is closed,
+	// i.e. the HTTP server depends on the workers, which depend on the database.
+	DependsOn []string
+	// Phase closes the services in ascending order, every service of a phase is closed before the next phase starts.
+	Phase int
+	// Timeout bounds Close, the default is the Timeout option.
+	Timeout time.Duration
 }
 
 // Single allows for a single Service to operate.
@@ -67,30 +133,68 @@ func Single(service Service, opts ...Option) (chan os.Signal, error) {
 	return Multiple([]Service{service}, opts...)
 }
 
-// Multiple allows for multiple services to operate.
-func Multiple(services []Service, opts ...Option) (chan os.Signal, error) {
+func newConfig(opts ...Option) (config, error) {
 
 	cfg := config{
 		timeout: 5 * time.Second,
 		logger:  slog.Default(),
-	}
-
-	if len(services) < 1 {
-		return nil, ErrMissingServices
+		signals: []os.Signal{os.Interrupt, syscall.SIGTERM},
+		reload:  []os.Signal{syscall.SIGHUP},
 	}
 
 	var err error
 
 	for _, opt := range opts {
-		err = errors.Join(opt.apply(&cfg))
+		err = errors.Join(err, opt.apply(&cfg))
+	}
+
+	if err != nil {
+		return cfg, err
+	}
+
+	// Only the signals that Run listens for can overlap.
+	sets := [][]os.Signal{cfg.signals}
+
+	if len(cfg.reloaders) > 0 {
+		sets = append(sets, cfg.reload)
+	}
+
+	if cfg.listeners != nil {
+		sets = append(sets, cfg.handoff)
+	}
+
+	seen := make(map[os.Signal]int)
+
+	for x, set := range sets {
+		for _, sig := range set {
+
+			if y, ok := seen[sig]; ok && y != x {
+				return cfg, fmt.Errorf("%w: %s", ErrSignalOverlap, sig)
+			}
+
+			seen[sig] = x
+		}
 	}
 
+	return cfg, nil
+}
+
+// Multiple allows for multiple services to operate.
+//
+// Deprecated: Multiple returns right away and only logs errors, use Run to wait for the services and get their errors.
+func Multiple(services []Service, opts ...Option) (chan os.Signal, error) {
+
+	if len(services) < 1 {
+		return nil, ErrMissingServices
+	}
+
+	cfg, err := newConfig(opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(quit, cfg.signals...)
 
 	for _, service := range services {
 
@@ -122,3 +226,257 @@ func Multiple(services []Service, opts ...Option) (chan os.Signal, error) {
 	return quit, nil
 
 }
+
+// Run starts the services and blocks until a signal is received, ctx is done or a service fails to start.
+// The services are then closed, concurrently unless DependsOn or Phase say otherwise, each within its timeout,
+// and Run returns once they have all stopped. Services are closed even if what they depend on failed to close.
+//
+// A service that is still closing after its timeout is left behind with ErrTimeout, Run does not wait for it.
+//
+// The error joins what the services returned from Start and Close. http.ErrServerClosed is not an error,
+// and neither is the cancellation of ctx, which is just another way to ask for the shutdown.
+// While waiting, the signals of Reload and Handoff are handled too.
+func Run(ctx context.Context, services []Service, opts ...Option) error {
+
+	if len(services) < 1 {
+		return ErrMissingServices
+	}
+
+	for _, service := range services {
+
+		if service.Start == nil || service.Close == nil {
+			return ErrInvalidService
+		}
+
+		if service.Timeout < 0 {
+			return ErrInvalidDuration
+		}
+	}
+
+	before, err := order(services)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return err
+	}
+
+	notified, stop := signal.NotifyContext(ctx, cfg.signals...)
+	defer stop()
+
+	var (
+		mu      sync.Mutex
+		errs    []error
+		started sync.WaitGroup
+		failed  = make(chan struct{})
+		once    sync.Once
+	)
+
+	collect := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	for x, service := range services {
+
+		x, service := x, service
+
+		started.Add(1)
+
+		go func() {
+
+			defer started.Done()
+
+			if err := service.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				collect(fmt.Errorf("%s: %w", name(services, x), err))
+				once.Do(func() { close(failed) })
+			}
+
+		}()
+	}
+
+	// Services that return from Start on their own are done, when all of them are there is nothing to wait for.
+	finished := make(chan struct{})
+
+	go func() {
+		started.Wait()
+		close(finished)
+	}()
+
+	// A nil channel never receives, so without Handoff it is never picked.
+	var handoff chan os.Signal
+
+	if cfg.listeners != nil {
+		handoff = make(chan os.Signal, 1)
+		signal.Notify(handoff, cfg.handoff...)
+		defer signal.Stop(handoff)
+	}
+
+	var (
+		reload    chan os.Signal
+		reloading = make(chan struct{}, 1)
+		reloaded  = make(chan struct{})
+	)
+
+	if len(cfg.reloaders) > 0 {
+		reload = make(chan os.Signal, 1)
+		signal.Notify(reload, cfg.reload...)
+		defer signal.Stop(reload)
+	}
+
+	// Reloads run one at a time away from the signals, so a slow one does not hold up the shutdown,
+	// which cancels it. Signals received during a reload start a single other one.
+	go func() {
+
+		defer close(reloaded)
+
+		for range reloading {
+			cfg.reloadAll(notified)
+		}
+	}()
+
+wait:
+	for {
+		select {
+		case <-notified.Done():
+			cfg.logger.LogAttrs(ctx, slog.LevelInfo, "shutting down", slog.String("reason", reason(ctx)))
+			break wait
+		case <-failed:
+			cfg.logger.LogAttrs(ctx, slog.LevelError, "shutting down", slog.String("reason", "a service failed to start"))
+			break wait
+		case <-finished:
+			// Usually a Start that does not block, which would look like a clean exit otherwise.
+			if notified.Err() == nil {
+				cfg.logger.LogAttrs(ctx, slog.LevelWarn, "shutting down", slog.String("reason", "every service returned from Start"))
+			}
+			break wait
+		case <-reload:
+			select {
+			case reloading <- struct{}{}:
+			default:
+			}
+		case <-handoff:
+
+			process, err := cfg.listeners.Upgrade()
+			if err != nil {
+				cfg.logger.LogAttrs(ctx, slog.LevelError, "unable to hand off listeners", slog.String("error", err.Error()))
+				continue
+			}
+
+			// The new process is not waited for, it outlives this one.
+			_ = process.Release()
+
+			cfg.logger.LogAttrs(ctx, slog.LevelInfo, "shutting down", slog.String("reason", "listeners handed off"), slog.Int("pid", process.Pid))
+			break wait
+		}
+	}
+
+	stop()
+
+	// The shutdown keeps the values of ctx, but not its cancellation.
+	base := context.WithoutCancel(ctx)
+	begin := time.Now()
+
+	close(reloading)
+
+	// The reload was cancelled with stop, a reloader ignoring it is not waited for past the timeout.
+	abandon := time.NewTimer(cfg.timeout)
+
+	select {
+	case <-reloaded:
+	case <-abandon.C:
+		cfg.logger.LogAttrs(base, slog.LevelWarn, "reload still running, shutting down anyway")
+	}
+
+	abandon.Stop()
+
+	closed := make([]chan struct{}, len(services))
+
+	for x := range closed {
+		closed[x] = make(chan struct{})
+	}
+
+	for x, service := range services {
+
+		x, service := x, service
+
+		go func() {
+
+			defer close(closed[x])
+
+			for _, y := range before[x] {
+				<-closed[y]
+			}
+
+			timeout := service.Timeout
+			if timeout == 0 {
+				timeout = cfg.timeout
+			}
+
+			shutdown, cancel := context.WithTimeout(base, timeout)
+			defer cancel()
+
+			attrs := []slog.Attr{slog.String("service", name(services, x)), slog.Int("phase", service.Phase)}
+
+			cfg.logger.LogAttrs(shutdown, slog.LevelInfo, "closing service", attrs...)
+
+			started := time.Now()
+
+			// A Close that ignores its context is given up on, so the services depending on it are still closed.
+			result := make(chan error, 1)
+
+			go func() {
+				result <- service.Close(shutdown)
+			}()
+
+			var err error
+
+			select {
+			case err = <-result:
+			case <-shutdown.Done():
+				err = fmt.Errorf("%w: %w", ErrTimeout, shutdown.Err())
+			}
+
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				cfg.logger.LogAttrs(shutdown, slog.LevelError, "unable to close service", append(attrs, slog.String("error", err.Error()))...)
+				collect(fmt.Errorf("%s: %w", name(services, x), err))
+				return
+			}
+
+			cfg.logger.LogAttrs(shutdown, slog.LevelInfo, "closed service", append(attrs, slog.Duration("duration", time.Since(started)))...)
+
+		}()
+	}
+
+	for _, done := range closed {
+		<-done
+	}
+
+	wait, cancel := context.WithTimeout(base, cfg.timeout)
+	defer cancel()
+
+	select {
+	case <-finished:
+	case <-wait.Done():
+		collect(ErrTimeout)
+	}
+
+	cfg.logger.LogAttrs(base, slog.LevelInfo, "shut down", slog.Duration("duration", time.Since(begin)))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+func reason(ctx context.Context) string {
+
+	if ctx.Err() != nil {
+		return "context done"
+	}
+
+	return "signal received"
+}
@@ -1,12 +1,14 @@
 package graceful
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -120,3 +122,336 @@ func TestSingle(t *testing.T) {
 	check.Error(err)
 
 }
+
+// listening returns a Service serving on a random port, along with its address.
+func listening(t *testing.T) (Service, string) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	return Service{
+		Start: func() error { return server.Serve(l) },
+		Close: server.Shutdown,
+	}, "http://" + l.Addr().String()
+}
+
+func TestRunErrors(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+
+	check.ErrorIs(Run(ctx, nil), ErrMissingServices)
+	check.ErrorIs(Run(ctx, []Service{{Start: func() error { return nil }}}), ErrInvalidService)
+
+	service, _ := listening(t)
+	check.ErrorIs(Run(ctx, []Service{service}, Signals()), ErrMissingSignals)
+	check.ErrorIs(Run(ctx, []Service{service}, Timeout(-1), Signals()), ErrInvalidDuration)
+}
+
+func TestRunContext(t *testing.T) {
+
+	check := require.New(t)
+
+	first, addr := listening(t)
+	second, _ := listening(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(ctx, []Service{first, second}, Logger(slogt.New(t)))
+	}()
+
+	check.Eventually(func() bool {
+		resp, err := http.Get(addr)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	// http.ErrServerClosed and the cancellation are not errors.
+	check.NoError(<-done)
+
+	_, err := http.Get(addr)
+	check.Error(err)
+}
+
+func TestRunSignal(t *testing.T) {
+
+	check := require.New(t)
+
+	service, _ := listening(t)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(context.Background(), []Service{service}, Signals(syscall.SIGUSR1))
+	}()
+
+	// Wait for Run to be listening for the signal.
+	time.Sleep(100 * time.Millisecond)
+
+	check.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case err := <-done:
+		check.NoError(err)
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the signal")
+	}
+}
+
+func TestRunStartError(t *testing.T) {
+
+	check := require.New(t)
+
+	service, _ := listening(t)
+
+	failing := errors.New("address in use")
+	closing := errors.New("unable to flush")
+
+	err := Run(context.Background(), []Service{
+		service,
+		{
+			Start: func() error { return failing },
+			Close: func(context.Context) error { return closing },
+		},
+	})
+
+	// The failure stops the other services, and every error is returned.
+	check.ErrorIs(err, failing)
+	check.ErrorIs(err, closing)
+}
+
+func TestRunTimeout(t *testing.T) {
+
+	check := require.New(t)
+
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Run(ctx, []Service{{
+		Start: func() error { <-stuck; return nil },
+		Close: func(context.Context) error { return nil },
+	}}, Timeout(50*time.Millisecond))
+
+	check.ErrorIs(err, ErrTimeout)
+}
+
+func TestRunStartReturned(t *testing.T) {
+
+	check := require.New(t)
+
+	var buf bytes.Buffer
+
+	// A Start that does not block ends Run, with a warning as nothing asked for the shutdown.
+	err := Run(context.Background(), []Service{{
+		Name:  "detached",
+		Start: func() error { return nil },
+		Close: func(context.Context) error { return nil },
+	}}, Logger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	check.NoError(err)
+	check.Contains(buf.String(), `level=WARN msg="shutting down" reason="every service returned from Start"`)
+}
+
+func TestOrder(t *testing.T) {
+
+	noop := func() error { return nil }
+	closer := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name     string
+		services []Service
+		wantErr  error
+	}{
+		{name: "unnamed", services: []Service{{Start: noop, Close: closer}, {Start: noop, Close: closer}}},
+		{name: "duplicate", services: []Service{{Name: "a", Start: noop, Close: closer}, {Name: "a", Start: noop, Close: closer}}, wantErr: ErrDuplicateName},
+		{name: "unknown", services: []Service{{Name: "a", DependsOn: []string{"b"}, Start: noop, Close: closer}}, wantErr: ErrUnknownDependency},
+		{name: "cycle", services: []Service{
+			{Name: "a", DependsOn: []string{"b"}, Start: noop, Close: closer},
+			{Name: "b", DependsOn: []string{"a"}, Start: noop, Close: closer},
+		}, wantErr: ErrDependencyCycle},
+		{name: "phase against dependency", services: []Service{
+			{Name: "http", Phase: 1, DependsOn: []string{"db"}, Start: noop, Close: closer},
+			{Name: "db", Start: noop, Close: closer},
+		}, wantErr: ErrDependencyCycle},
+		{name: "negative timeout", services: []Service{{Start: noop, Close: closer, Timeout: -1}}, wantErr: ErrInvalidDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := Run(ctx, tt.services)
+			if tt.wantErr != nil {
+				check.ErrorIs(err, tt.wantErr)
+			} else {
+				check.NoError(err)
+			}
+
+		})
+	}
+}
+
+func TestRunOrdered(t *testing.T) {
+
+	check := require.New(t)
+
+	var (
+		mu     sync.Mutex
+		closed []string
+	)
+
+	service := func(name string, phase int, dependsOn ...string) Service {
+
+		stop := make(chan struct{})
+
+		return Service{
+			Name:      name,
+			Phase:     phase,
+			DependsOn: dependsOn,
+			Start: func() error {
+				<-stop
+				return nil
+			},
+			Close: func(context.Context) error {
+				// Give anything closing out of order a chance to show up.
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				closed = append(closed, name)
+				mu.Unlock()
+				close(stop)
+				return nil
+			},
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	check.NoError(Run(ctx, []Service{
+		service("ent", 0),
+		service("workers", 0, "ent"),
+		service("http", 0, "workers"),
+		service("metrics", 1),
+	}, Logger(slogt.New(t))))
+
+	check.Equal([]string{"http", "workers", "ent", "metrics"}, closed)
+}
+
+func TestRunServiceTimeout(t *testing.T) {
+
+	check := require.New(t)
+
+	var (
+		buf    bytes.Buffer
+		mu     sync.Mutex
+		closed bool
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	slow := Service{
+		Name:    "slow",
+		Timeout: 20 * time.Millisecond,
+		Start:   func() error { return nil },
+		Close: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	db := Service{
+		Name:  "db",
+		Start: func() error { return nil },
+		Close: func(context.Context) error {
+			mu.Lock()
+			closed = true
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	slow.DependsOn = []string{"db"}
+
+	err := Run(ctx, []Service{slow, db}, Logger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	// The dependency is closed even though the slow service timed out.
+	check.ErrorIs(err, context.DeadlineExceeded)
+	check.ErrorContains(err, "slow")
+	check.True(closed)
+
+	check.Contains(buf.String(), `msg="closing service" service=slow phase=0`)
+	check.Contains(buf.String(), `msg="unable to close service" service=slow`)
+	check.Contains(buf.String(), `msg="closed service" service=db`)
+}
+
+func TestRunStuckClose(t *testing.T) {
+
+	check := require.New(t)
+
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+
+	var closed bool
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(ctx, []Service{
+			{
+				Name:      "stuck",
+				DependsOn: []string{"db"},
+				Timeout:   20 * time.Millisecond,
+				Start:     func() error { return nil },
+				Close: func(context.Context) error {
+					// Ignores its context.
+					<-stuck
+					return nil
+				},
+			},
+			{
+				Name:  "db",
+				Start: func() error { return nil },
+				Close: func(context.Context) error {
+					closed = true
+					return nil
+				},
+			},
+		}, Logger(slogt.New(t)))
+	}()
+
+	select {
+	case err := <-done:
+		check.ErrorIs(err, ErrTimeout)
+		check.ErrorIs(err, context.DeadlineExceeded)
+		check.ErrorContains(err, "stuck")
+		check.True(closed)
+	case <-time.After(5 * time.Second):
+		check.Fail("Run did not return")
+	}
+}
@@ -0,0 +1,185 @@
+package graceful
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidListenFDs = errors.New("invalid LISTEN_FDS")
+	ErrNotInheritable   = errors.New("listener can not be handed off")
+	ErrHandoffSupport   = errors.New("listeners can not be handed off on this platform")
+)
+
+const (
+	envListenFDs     = "LISTEN_FDS"
+	envListenPID     = "LISTEN_PID"
+	envListenFDNames = "LISTEN_FDNAMES"
+
+	// listenFDsStart is the first inherited file descriptor, after stdin, stdout and stderr.
+	listenFDsStart = 3
+)
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+type inherited struct {
+	name     string
+	listener net.Listener
+}
+
+type active struct {
+	name     string
+	listener net.Listener
+}
+
+// Listeners hands listening sockets from one process to the next, so restarts do not refuse connections.
+// It inherits them from systemd socket activation, or from the process that started this one with Upgrade.
+type Listeners struct {
+	mu        sync.Mutex
+	inherited []inherited
+	active    []active
+
+	// argv and env start the new process, they are only changed by the tests.
+	argv []string
+	env  []string
+}
+
+// Inherit takes the listeners passed by systemd or by Upgrade with LISTEN_FDS, and removes the variables from the environment
+// so they are not passed on to other processes. Without LISTEN_FDS there is nothing to inherit.
+// When LISTEN_PID is set it must be this process, as systemd sets it; Upgrade does not set it.
+func Inherit() (*Listeners, error) {
+
+	l := &Listeners{}
+
+	count := os.Getenv(envListenFDs)
+	if count == "" {
+		return l, nil
+	}
+
+	pid := os.Getenv(envListenPID)
+	names := os.Getenv(envListenFDNames)
+
+	for _, key := range []string{envListenFDs, envListenPID, envListenFDNames} {
+		os.Unsetenv(key)
+	}
+
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return l, nil
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return nil, ErrInvalidListenFDs
+	}
+
+	var list []string
+	if names != "" {
+		list = strings.Split(names, ":")
+	}
+
+	for x := 0; x < n; x++ {
+
+		fd := listenFDsStart + x
+
+		closeOnExec(fd)
+
+		name := ""
+		if x < len(list) {
+			name, _ = url.QueryUnescape(list[x])
+		}
+
+		f := os.NewFile(uintptr(fd), "listener "+name)
+
+		ln, err := net.FileListener(f)
+
+		// FileListener works on a copy.
+		f.Close()
+
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("%w: file descriptor %d: %w", ErrInvalidListenFDs, fd, err)
+		}
+
+		l.inherited = append(l.inherited, inherited{name: name, listener: ln})
+	}
+
+	return l, nil
+}
+
+// Listen returns the inherited listener named addr, or listening on addr, binding a new one when there is none.
+// The listeners returned are the ones Upgrade hands off.
+func (l *Listeners) Listen(network, addr string) (net.Listener, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for x, single := range l.inherited {
+
+		if single.name != addr && !sameAddr(single.listener.Addr(), network, addr) {
+			continue
+		}
+
+		l.inherited = append(l.inherited[:x], l.inherited[x+1:]...)
+		l.active = append(l.active, active{name: addr, listener: single.listener})
+
+		return single.listener, nil
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l.active = append(l.active, active{name: addr, listener: ln})
+
+	return ln, nil
+}
+
+// sameAddr reports if the listener is bound to addr.
+func sameAddr(bound net.Addr, network, addr string) bool {
+
+	if bound.Network() != network && !(strings.HasPrefix(network, "tcp") && bound.Network() == "tcp") {
+		return false
+	}
+
+	if network == "unix" {
+		return bound.String() == addr
+	}
+
+	want, err := net.ResolveTCPAddr(network, addr)
+	if err != nil {
+		return false
+	}
+
+	got, ok := bound.(*net.TCPAddr)
+	if !ok || want.Port == 0 || got.Port != want.Port {
+		return false
+	}
+
+	return got.IP.Equal(want.IP) || (got.IP.IsUnspecified() && (want.IP == nil || want.IP.IsUnspecified()))
+}
+
+// Close closes the inherited listeners that were not used.
+func (l *Listeners) Close() error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+
+	for _, single := range l.inherited {
+		err = errors.Join(err, single.listener.Close())
+	}
+
+	l.inherited = nil
+
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package graceful
+
+import (
+	"os"
+)
+
+// defaultHandoff is empty, Handoff is not supported here.
+var defaultHandoff []os.Signal
+
+func closeOnExec(int) {}
+
+// Upgrade returns ErrHandoffSupport, listeners are only handed off on unix.
+func (l *Listeners) Upgrade() (*os.Process, error) {
+	return nil, ErrHandoffSupport
+}
@@ -0,0 +1,180 @@
+//go:build unix
+
+package graceful
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperListener is the new process started by Upgrade, it answers one connection on the inherited listener.
+func TestHelperListener(t *testing.T) {
+
+	if os.Getenv("GRACEFUL_HELPER") != "1" {
+		t.Skip("only run by Upgrade")
+	}
+
+	l, err := Inherit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// The same address as the parent, which is only found when inherited.
+	ln, err := l.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(conn, "child %d\n", os.Getpid())
+	conn.Close()
+
+	os.Exit(0)
+}
+
+func TestInherit(t *testing.T) {
+
+	check := require.New(t)
+
+	l, err := Inherit()
+	check.NoError(err)
+	check.Empty(l.inherited)
+
+	t.Setenv(envListenFDs, "many")
+	_, err = Inherit()
+	check.ErrorIs(err, ErrInvalidListenFDs)
+
+	// Meant for another process.
+	t.Setenv(envListenFDs, "1")
+	t.Setenv(envListenPID, strconv.Itoa(os.Getpid()+1))
+
+	l, err = Inherit()
+	check.NoError(err)
+	check.Empty(l.inherited)
+	check.Empty(os.Getenv(envListenFDs))
+}
+
+func TestSameAddr(t *testing.T) {
+
+	bound := &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}
+
+	tests := []struct {
+		network string
+		addr    string
+		want    bool
+	}{
+		{network: "tcp", addr: ":8080", want: true},
+		{network: "tcp4", addr: "0.0.0.0:8080", want: true},
+		{network: "tcp", addr: ":8081"},
+		{network: "tcp", addr: "127.0.0.1:8080"},
+		{network: "tcp", addr: ":0"},
+		{network: "unix", addr: "/tmp/socket"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network+" "+tt.addr, func(t *testing.T) {
+			require.Equal(t, tt.want, sameAddr(bound, tt.network, tt.addr))
+		})
+	}
+}
+
+func TestHandoff(t *testing.T) {
+
+	check := require.New(t)
+
+	check.ErrorIs(Run(context.Background(), []Service{{Start: func() error { return nil }, Close: func(context.Context) error { return nil }}}, Handoff(nil)), ErrMissingListeners)
+
+	l, err := Inherit()
+	check.NoError(err)
+
+	ln, err := l.Listen("tcp", "127.0.0.1:0")
+	check.NoError(err)
+
+	l.argv = []string{os.Args[0], "-test.run=^TestHelperListener$"}
+	l.env = []string{"GRACEFUL_HELPER=1"}
+
+	stop := make(chan struct{})
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(context.Background(), []Service{{
+			Name:  "listener",
+			Start: func() error { <-stop; return nil },
+			Close: func(context.Context) error {
+				close(stop)
+				return ln.Close()
+			},
+		}}, Handoff(l, syscall.SIGUSR2), Logger(slogt.New(t)))
+	}()
+
+	// Wait for Run to be listening for the signal.
+	time.Sleep(100 * time.Millisecond)
+
+	check.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGUSR2))
+
+	select {
+	case err := <-done:
+		check.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the handoff")
+	}
+
+	// The old process has closed its listener, the connection reaches the new one.
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), 5*time.Second)
+	check.NoError(err)
+	defer conn.Close()
+
+	check.NoError(conn.SetDeadline(time.Now().Add(5 * time.Second)))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	check.NoError(err)
+	check.Contains(line, "child")
+	check.NotContains(line, fmt.Sprintf("child %d\n", os.Getpid()))
+}
+
+// plain is a listener that can not be handed off.
+type plain struct {
+	net.Listener
+}
+
+func TestUpgradeFailed(t *testing.T) {
+
+	check := require.New(t)
+
+	l, err := Inherit()
+	check.NoError(err)
+
+	path := filepath.Join(t.TempDir(), "socket")
+
+	ln, err := l.Listen("unix", path)
+	check.NoError(err)
+
+	l.active = append(l.active, active{name: "plain", listener: plain{ln}})
+
+	_, err = l.Upgrade()
+	check.ErrorIs(err, ErrNotInheritable)
+
+	// Nothing was handed off, so closing the listener still removes the socket.
+	check.NoError(ln.Close())
+
+	_, err = os.Stat(path)
+	check.ErrorIs(err, os.ErrNotExist)
+}
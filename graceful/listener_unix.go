@@ -0,0 +1,93 @@
+//go:build unix
+
+package graceful
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// defaultHandoff is the signal Handoff listens for when given none.
+var defaultHandoff = []os.Signal{syscall.SIGUSR2}
+
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
+
+// Upgrade starts the executable again with the same arguments, handing it the listeners.
+// The new process gets them back with Inherit and Listen with the same addresses.
+// Once it returns, this process should shut down, which Handoff does with Run.
+// The new process is only started, not known to be serving: if it fails before accepting, connections
+// queue on the listeners until they time out, with no process left to serve them.
+func (l *Listeners) Upgrade() (*os.Process, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	files := make([]*os.File, 0, len(l.active))
+	names := make([]string, 0, len(l.active))
+
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, single := range l.active {
+
+		fl, ok := single.listener.(filer)
+		if !ok {
+			return nil, ErrNotInheritable
+		}
+
+		f, err := fl.File()
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+		names = append(names, url.QueryEscape(single.name))
+	}
+
+	argv := l.argv
+	if argv == nil {
+		argv = os.Args
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+
+	// A LISTEN_PID left by systemd would make the new process ignore the listeners.
+	for _, single := range append(os.Environ(), l.env...) {
+		if key, _, _ := strings.Cut(single, "="); key != envListenFDs && key != envListenPID && key != envListenFDNames {
+			env = append(env, single)
+		}
+	}
+
+	env = append(env, envListenFDs+"="+strconv.Itoa(len(files)), envListenFDNames+"="+strings.Join(names, ":"))
+
+	process, err := os.StartProcess(executable, argv, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Closing these must not remove the sockets the new process is using, only once it has them.
+	for _, single := range l.active {
+		if unix, ok := single.listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+
+	return process, nil
+}
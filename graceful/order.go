@@ -0,0 +1,108 @@
+package graceful
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrDuplicateName     = errors.New("service names must be unique")
+	ErrUnknownDependency = errors.New("service depends on an unknown service")
+	ErrDependencyCycle   = errors.New("services depend on each other")
+)
+
+// name returns the name of the service at x, for the logs.
+func name(services []Service, x int) string {
+
+	if services[x].Name != "" {
+		return services[x].Name
+	}
+
+	return fmt.Sprintf("service %d", x)
+}
+
+// order returns, for every service, the services that must be closed before it:
+// the ones that depend on it, and the ones in an earlier phase.
+func order(services []Service) ([][]int, error) {
+
+	index := make(map[string]int, len(services))
+
+	for x, service := range services {
+
+		if service.Name == "" {
+			continue
+		}
+
+		if _, ok := index[service.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateName, service.Name)
+		}
+
+		index[service.Name] = x
+	}
+
+	before := make([][]int, len(services))
+
+	for x, service := range services {
+
+		for _, dependency := range service.DependsOn {
+
+			y, ok := index[dependency]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s depends on %s", ErrUnknownDependency, name(services, x), dependency)
+			}
+
+			// The dependency stays up until the service is closed.
+			if !slices.Contains(before[y], x) {
+				before[y] = append(before[y], x)
+			}
+		}
+
+		for y, other := range services {
+			if other.Phase < service.Phase && !slices.Contains(before[x], y) {
+				before[x] = append(before[x], y)
+			}
+		}
+	}
+
+	// Phases that contradict the dependencies show up as cycles too.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(services))
+
+	var visit func(x int) error
+
+	visit = func(x int) error {
+
+		switch state[x] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, name(services, x))
+		case visited:
+			return nil
+		}
+
+		state[x] = visiting
+
+		for _, y := range before[x] {
+			if err := visit(y); err != nil {
+				return err
+			}
+		}
+
+		state[x] = visited
+
+		return nil
+	}
+
+	for x := range services {
+		if err := visit(x); err != nil {
+			return nil, err
+		}
+	}
+
+	return before, nil
+}
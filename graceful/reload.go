@@ -0,0 +1,173 @@
+package graceful
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	ErrEmptyName = errors.New("name is empty")
+	ErrNilLoader = errors.New("loader is nil")
+	ErrNilReload = errors.New("reload function is nil")
+	ErrNilLevel  = errors.New("level is nil")
+)
+
+// ReloadFunc re-reads part of the configuration. When it fails the previous configuration must be kept.
+type ReloadFunc func(ctx context.Context) error
+
+type reloader struct {
+	name string
+	fn   ReloadFunc
+}
+
+// Reload makes Run call fn when one of the reload signals is received, syscall.SIGHUP by default.
+// Reloaders run one after the other within the timeout, failures are logged and do not stop the others.
+// A shutdown cancels the reload, the reloaders that did not start yet are skipped.
+func Reload(name string, fn ReloadFunc) Option {
+	return option(func(c *config) error {
+
+		if name == "" {
+			return ErrEmptyName
+		}
+
+		if fn == nil {
+			return ErrNilReload
+		}
+
+		c.reloaders = append(c.reloaders, reloader{name: name, fn: fn})
+
+		return nil
+	})
+}
+
+// ReloadSignals sets the signals that trigger the reloaders, they must not be the ones of Signals or Handoff.
+func ReloadSignals(signals ...os.Signal) Option {
+	return option(func(c *config) error {
+
+		if len(signals) < 1 {
+			return ErrMissingSignals
+		}
+
+		c.reload = signals
+
+		return nil
+	})
+}
+
+// reloadAll runs the reloaders, logging how each one went.
+func (c *config) reloadAll(ctx context.Context) {
+
+	for _, r := range c.reloaders {
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		rctx, cancel := context.WithTimeout(ctx, c.timeout)
+
+		if err := r.fn(rctx); err != nil {
+			c.logger.LogAttrs(rctx, slog.LevelError, "unable to reload, keeping the previous configuration", slog.String("reloader", r.name), slog.String("error", err.Error()))
+		} else {
+			c.logger.LogAttrs(rctx, slog.LevelInfo, "reloaded", slog.String("reloader", r.name))
+		}
+
+		cancel()
+	}
+}
+
+// Reloadable holds a value that is swapped atomically when it is reloaded, readers always see a complete value.
+//
+//	origins, err := graceful.NewReloadable(ctx, loadOrigins)
+//	cors.Store(cors.OriginStoreFunc(func(_ context.Context, origin string) (bool, error) {
+//		return slices.Contains(origins.Load(), origin), nil
+//	}))
+//	graceful.Run(ctx, services, graceful.Reload("origins", origins.Reload))
+type Reloadable[T any] struct {
+	value atomic.Pointer[T]
+	load  func(context.Context) (T, error)
+}
+
+// NewReloadable loads the first value, which must succeed.
+func NewReloadable[T any](ctx context.Context, load func(context.Context) (T, error)) (*Reloadable[T], error) {
+
+	if load == nil {
+		return nil, ErrNilLoader
+	}
+
+	r := &Reloadable[T]{load: load}
+
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Load returns the current value.
+func (r *Reloadable[T]) Load() T {
+	return *r.value.Load()
+}
+
+// Reload loads a new value, keeping the current one when it fails.
+func (r *Reloadable[T]) Reload(ctx context.Context) error {
+
+	value, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.value.Store(&value)
+
+	return nil
+}
+
+// ReloadLevel sets level to what load returns, i.e. the level of the logger given to reverb.SetLogger:
+//
+//	level := new(slog.LevelVar)
+//	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+func ReloadLevel(level *slog.LevelVar, load func(context.Context) (slog.Level, error)) ReloadFunc {
+	return func(ctx context.Context) error {
+
+		if level == nil {
+			return ErrNilLevel
+		}
+
+		if load == nil {
+			return ErrNilLoader
+		}
+
+		l, err := load(ctx)
+		if err != nil {
+			return err
+		}
+
+		level.Set(l)
+
+		return nil
+	}
+}
+
+// LoadCertificate reads a PEM encoded certificate and key, for a Reloadable used with GetCertificate.
+func LoadCertificate(certFile, keyFile string) func(context.Context) (*tls.Certificate, error) {
+	return func(context.Context) (*tls.Certificate, error) {
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cert, nil
+	}
+}
+
+// GetCertificate serves the current certificate, for tls.Config.GetCertificate.
+// New connections get the reloaded certificate, established ones are not affected.
+func GetCertificate(cert *Reloadable[*tls.Certificate]) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cert.Load(), nil
+	}
+}
@@ -0,0 +1,306 @@
+package graceful
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadable(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+
+	_, err := NewReloadable[int](ctx, nil)
+	check.ErrorIs(err, ErrNilLoader)
+
+	broken := errors.New("invalid configuration")
+
+	_, err = NewReloadable(ctx, func(context.Context) (int, error) { return 0, broken })
+	check.ErrorIs(err, broken)
+
+	var (
+		next = 1
+		fail bool
+	)
+
+	r, err := NewReloadable(ctx, func(context.Context) (int, error) {
+		if fail {
+			return 0, broken
+		}
+		next++
+		return next - 1, nil
+	})
+	check.NoError(err)
+	check.Equal(1, r.Load())
+
+	check.NoError(r.Reload(ctx))
+	check.Equal(2, r.Load())
+
+	// A failed reload keeps the previous value.
+	fail = true
+	check.ErrorIs(r.Reload(ctx), broken)
+	check.Equal(2, r.Load())
+}
+
+func TestReloadLevel(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	level := new(slog.LevelVar)
+
+	check.ErrorIs(ReloadLevel(nil, nil)(ctx), ErrNilLevel)
+	check.ErrorIs(ReloadLevel(level, nil)(ctx), ErrNilLoader)
+
+	check.NoError(ReloadLevel(level, func(context.Context) (slog.Level, error) { return slog.LevelDebug, nil })(ctx))
+	check.Equal(slog.LevelDebug, level.Level())
+
+	check.Error(ReloadLevel(level, func(context.Context) (slog.Level, error) { return slog.LevelError, errors.New("unreadable") })(ctx))
+	check.Equal(slog.LevelDebug, level.Level())
+}
+
+// writeCertificate writes a self signed certificate for name, returning the paths of the certificate and the key.
+func writeCertificate(t *testing.T, dir, name string) (string, string) {
+
+	check := require.New(t)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	check.NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	check.NoError(err)
+
+	key, err := x509.MarshalPKCS8PrivateKey(priv)
+	check.NoError(err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	check.NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	check.NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+
+	return certFile, keyFile
+}
+
+func TestCertificate(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	certFile, keyFile := writeCertificate(t, dir, "old.example.com")
+
+	cert, err := NewReloadable(ctx, LoadCertificate(certFile, keyFile))
+	check.NoError(err)
+
+	get := GetCertificate(cert)
+
+	served, err := get(nil)
+	check.NoError(err)
+
+	leaf, err := x509.ParseCertificate(served.Certificate[0])
+	check.NoError(err)
+	check.Equal("old.example.com", leaf.Subject.CommonName)
+
+	writeCertificate(t, dir, "new.example.com")
+	check.NoError(cert.Reload(ctx))
+
+	served, err = get(nil)
+	check.NoError(err)
+
+	leaf, err = x509.ParseCertificate(served.Certificate[0])
+	check.NoError(err)
+	check.Equal("new.example.com", leaf.Subject.CommonName)
+
+	// A broken file keeps the certificate being served.
+	check.NoError(os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	check.Error(cert.Reload(ctx))
+
+	again, err := get(nil)
+	check.NoError(err)
+	check.Same(served, again)
+}
+
+func TestRunReload(t *testing.T) {
+
+	check := require.New(t)
+
+	var (
+		mu   sync.Mutex
+		buf  bytes.Buffer
+		runs int
+	)
+
+	reloaded := make(chan struct{}, 1)
+
+	stop := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(ctx, []Service{{
+			Start: func() error { <-stop; return nil },
+			Close: func(context.Context) error { close(stop); return nil },
+		}},
+			ReloadSignals(syscall.SIGUSR1),
+			Reload("broken", func(context.Context) error { return errors.New("invalid configuration") }),
+			Reload("counter", func(context.Context) error {
+				mu.Lock()
+				runs++
+				mu.Unlock()
+				reloaded <- struct{}{}
+				return nil
+			}),
+			Logger(slog.New(slog.NewTextHandler(&syncWriter{w: &buf, mu: &mu}, nil))),
+		)
+	}()
+
+	// Wait for Run to be listening for the signal.
+	time.Sleep(100 * time.Millisecond)
+
+	for x := 0; x < 2; x++ {
+
+		check.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+
+		select {
+		case <-reloaded:
+		case <-time.After(time.Second):
+			t.Fatal("the reloaders did not run")
+		}
+	}
+
+	// The services keep running after a failed reloader.
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned after a reload: %v", err)
+	default:
+	}
+
+	cancel()
+	check.NoError(<-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	check.Equal(2, runs)
+	check.Contains(buf.String(), `msg="unable to reload, keeping the previous configuration" reloader=broken error="invalid configuration"`)
+	check.Contains(buf.String(), `msg=reloaded reloader=counter`)
+
+	service := []Service{{Start: func() error { return nil }, Close: func(context.Context) error { return nil }}}
+
+	check.ErrorIs(Run(ctx, service, Reload("", func(context.Context) error { return nil })), ErrEmptyName)
+	check.ErrorIs(Run(ctx, service, Reload("level", nil)), ErrNilReload)
+	check.ErrorIs(Run(ctx, service, ReloadSignals()), ErrMissingSignals)
+
+	noop := Reload("noop", func(context.Context) error { return nil })
+
+	check.ErrorIs(Run(ctx, service, noop, ReloadSignals(syscall.SIGUSR2), Handoff(&Listeners{})), ErrSignalOverlap)
+	check.ErrorIs(Run(ctx, service, noop, ReloadSignals(syscall.SIGTERM)), ErrSignalOverlap)
+	check.ErrorIs(Run(ctx, service, Handoff(&Listeners{}, os.Interrupt)), ErrSignalOverlap)
+
+	// Without reloaders the reload signals are not listened for.
+	check.NoError(Run(ctx, service, ReloadSignals(syscall.SIGUSR2), Handoff(&Listeners{})))
+}
+
+func TestRunReloadShutdown(t *testing.T) {
+
+	check := require.New(t)
+
+	var skipped atomic.Bool
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	stop := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Run(ctx, []Service{{
+			Start: func() error { <-stop; return nil },
+			Close: func(context.Context) error { close(stop); return nil },
+		}},
+			Timeout(time.Minute),
+			Signals(syscall.SIGUSR2),
+			ReloadSignals(syscall.SIGUSR1),
+			Reload("slow", func(ctx context.Context) error {
+				close(started)
+				<-ctx.Done()
+				cancelled <- ctx.Err()
+				return ctx.Err()
+			}),
+			Reload("next", func(context.Context) error {
+				skipped.Store(true)
+				return nil
+			}),
+			Logger(slogt.New(t)),
+		)
+	}()
+
+	// Wait for Run to be listening for the signal.
+	time.Sleep(100 * time.Millisecond)
+
+	check.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the reloader did not run")
+	}
+
+	// The shutdown is not held up by the reload, which is cancelled.
+	check.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGUSR2))
+
+	select {
+	case err := <-done:
+		check.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return during a reload")
+	}
+
+	check.ErrorIs(<-cancelled, context.Canceled)
+	check.False(skipped.Load())
+}
+
+type syncWriter struct {
+	w  *bytes.Buffer
+	mu *sync.Mutex
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
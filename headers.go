@@ -0,0 +1,54 @@
+package reverb
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/hcarriz/reverb/headers"
+	"github.com/labstack/echo/v4"
+)
+
+// SecurityHeaders sets the security headers on every response, see the headers package for the options.
+// Use headers.Renderer with the renderer so templates can read the nonce of the content security policy.
+func SecurityHeaders(opts ...headers.Option) Option {
+	return option(func(c *config) error {
+
+		mw, err := headers.New(opts...)
+		if err != nil {
+			return err
+		}
+
+		c.echo.Use(mw)
+
+		return nil
+	})
+}
+
+// CSPReports logs the content security policy violations posted to path with the logger, see headers.CSP.ReportTo
+// and headers.ReportHandler for the limits.
+// Browsers do not send a csrf token with reports, so exempt path with csrf.Skipper when CSRF is used.
+func CSPReports(path string) Option {
+	return option(func(c *config) error {
+
+		if path == "" {
+			return ErrEmptyPath
+		}
+
+		// The logger can still be changed by the options that follow, so the handler is built on the first report.
+		build := sync.OnceValues(func() (echo.HandlerFunc, error) {
+			return headers.ReportHandler(c.logger)
+		})
+
+		c.echo.POST(path, func(ctx echo.Context) error {
+
+			handler, err := build()
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+
+			return handler(ctx)
+		})
+
+		return nil
+	})
+}
@@ -0,0 +1,205 @@
+package headers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/hcarriz/reverb/renderer"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrInvalidSource    = errors.New("invalid content security policy source")
+	ErrInvalidDirective = errors.New("invalid content security policy directive")
+)
+
+// ContextKey is the key the nonce is stored under in the echo.Context.
+const ContextKey = "csp_nonce"
+
+// reportGroup is the Reporting-Endpoints name used by the report-to directive.
+const reportGroup = "csp-endpoint"
+
+// Directive is a content security policy directive.
+type Directive string
+
+const (
+	DefaultSrc              Directive = "default-src"
+	ScriptSrc               Directive = "script-src"
+	StyleSrc                Directive = "style-src"
+	ImgSrc                  Directive = "img-src"
+	ConnectSrc              Directive = "connect-src"
+	FontSrc                 Directive = "font-src"
+	ObjectSrc               Directive = "object-src"
+	MediaSrc                Directive = "media-src"
+	FrameSrc                Directive = "frame-src"
+	ChildSrc                Directive = "child-src"
+	WorkerSrc               Directive = "worker-src"
+	ManifestSrc             Directive = "manifest-src"
+	BaseURI                 Directive = "base-uri"
+	FormAction              Directive = "form-action"
+	FrameAncestors          Directive = "frame-ancestors"
+	UpgradeInsecureRequests Directive = "upgrade-insecure-requests"
+)
+
+// Sources that are keywords.
+const (
+	Self          = "'self'"
+	None          = "'none'"
+	UnsafeInline  = "'unsafe-inline'"
+	UnsafeEval    = "'unsafe-eval'"
+	StrictDynamic = "'strict-dynamic'"
+	// RequestNonce is replaced by the nonce of the request, i.e. 'nonce-Yk9Ld2Jx_...'.
+	RequestNonce = "'nonce'"
+)
+
+type directive struct {
+	name    Directive
+	sources []string
+}
+
+// CSP builds a content security policy. Directives keep the order they were first added in.
+//
+//	headers.NewCSP().
+//		Add(headers.DefaultSrc, headers.Self).
+//		Add(headers.ScriptSrc, headers.RequestNonce, headers.StrictDynamic).
+//		Add(headers.ObjectSrc, headers.None).
+//		ReportTo("/csp-reports")
+type CSP struct {
+	directives []directive
+	endpoint   string
+	err        error
+}
+
+// NewCSP returns an empty policy.
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// Add adds sources to the directive. Mistakes are returned by the option the policy is given to.
+func (p *CSP) Add(name Directive, sources ...string) *CSP {
+
+	if name == "" || strings.ContainsAny(string(name), " ;,") {
+		p.err = errors.Join(p.err, ErrInvalidDirective)
+		return p
+	}
+
+	for _, source := range sources {
+		if source == "" || strings.ContainsAny(source, " ;,\r\n\t") {
+			p.err = errors.Join(p.err, ErrInvalidSource)
+			return p
+		}
+	}
+
+	for x := range p.directives {
+		if p.directives[x].name == name {
+			p.directives[x].sources = append(p.directives[x].sources, sources...)
+			return p
+		}
+	}
+
+	p.directives = append(p.directives, directive{name: name, sources: sources})
+
+	return p
+}
+
+// ReportTo sends violations to uri with both report-uri and report-to, the latter through the Reporting-Endpoints header.
+// See ReportHandler for an endpoint that logs them.
+func (p *CSP) ReportTo(uri string) *CSP {
+
+	if uri == "" || strings.ContainsAny(uri, " ;,\"\r\n\t") {
+		p.err = errors.Join(p.err, ErrInvalidSource)
+		return p
+	}
+
+	p.endpoint = uri
+
+	return p
+}
+
+// String returns the policy, with RequestNonce where the nonce goes.
+func (p *CSP) String() string {
+	return p.render("")
+}
+
+func (p *CSP) usesNonce() bool {
+
+	if p == nil {
+		return false
+	}
+
+	for _, d := range p.directives {
+		for _, source := range d.sources {
+			if source == RequestNonce {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// render returns the policy with the nonce of the request.
+func (p *CSP) render(nonce string) string {
+
+	var b strings.Builder
+
+	for x, d := range p.directives {
+
+		if x > 0 {
+			b.WriteString("; ")
+		}
+
+		b.WriteString(string(d.name))
+
+		for _, source := range d.sources {
+
+			b.WriteByte(' ')
+
+			if source == RequestNonce && nonce != "" {
+				b.WriteString("'nonce-" + nonce + "'")
+				continue
+			}
+
+			b.WriteString(source)
+		}
+	}
+
+	if p.endpoint != "" {
+
+		if len(p.directives) > 0 {
+			b.WriteString("; ")
+		}
+
+		b.WriteString("report-uri " + p.endpoint + "; report-to " + reportGroup)
+	}
+
+	return b.String()
+}
+
+func generate() (string, error) {
+
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Nonce returns the nonce of the request, or an empty string if no policy uses RequestNonce.
+func Nonce(c echo.Context) string {
+
+	if value, ok := c.Get(ContextKey).(string); ok {
+		return value
+	}
+
+	return ""
+}
+
+// Renderer adds cspNonce to the templates of the renderer package, i.e. <script nonce="{{ cspNonce }}">.
+func Renderer() renderer.Option {
+	return renderer.ContextFunc("cspNonce", func(c echo.Context) any { return Nonce(c) })
+}
@@ -0,0 +1,111 @@
+package headers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hcarriz/reverb/renderer"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSP(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		policy  *CSP
+		want    string
+		wantErr error
+	}{
+		{name: "empty", policy: NewCSP()},
+		{
+			name:   "merged directives",
+			policy: NewCSP().Add(DefaultSrc, Self).Add(ImgSrc, Self, "data:").Add(DefaultSrc, "https://cdn.example.com").Add(UpgradeInsecureRequests),
+			want:   "default-src 'self' https://cdn.example.com; img-src 'self' data:; upgrade-insecure-requests",
+		},
+		{
+			name:   "nonce and report",
+			policy: NewCSP().Add(ScriptSrc, RequestNonce, StrictDynamic).Add(ObjectSrc, None).ReportTo("/csp-reports"),
+			want:   "script-src 'nonce' 'strict-dynamic'; object-src 'none'; report-uri /csp-reports; report-to csp-endpoint",
+		},
+		{name: "empty source", policy: NewCSP().Add(ScriptSrc, ""), wantErr: ErrInvalidSource},
+		{name: "injected directive", policy: NewCSP().Add("script-src; img-src", Self), wantErr: ErrInvalidDirective},
+		{name: "injected report", policy: NewCSP().ReportTo("/r; script-src *"), wantErr: ErrInvalidSource},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			check.ErrorIs(tt.policy.err, tt.wantErr)
+
+			if tt.wantErr == nil {
+				check.Equal(tt.want, tt.policy.String())
+			}
+
+		})
+	}
+}
+
+func TestNonce(t *testing.T) {
+
+	check := require.New(t)
+
+	mw, err := New(
+		ContentSecurityPolicy(NewCSP().Add(ScriptSrc, RequestNonce, StrictDynamic).ReportTo("/csp-reports")),
+		ContentSecurityPolicyReportOnly(NewCSP().Add(StyleSrc, RequestNonce).ReportTo("/csp-reports")),
+	)
+	check.NoError(err)
+
+	r, err := renderer.New(fstest.MapFS{
+		"page.html": {Data: []byte(`<script nonce="{{ cspNonce }}"></script>`)},
+	}, renderer.AddFiles("page.html"), Renderer())
+	check.NoError(err)
+
+	e := echo.New()
+	e.Renderer = r
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "page.html", nil)
+	})
+
+	nonce := regexp.MustCompile(`'nonce-([A-Za-z0-9_-]{22})'`)
+	seen := map[string]bool{}
+
+	for x := 0; x < 3; x++ {
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		check.Equal(http.StatusOK, rec.Code)
+
+		enforced := nonce.FindStringSubmatch(rec.Header().Get(echo.HeaderContentSecurityPolicy))
+		check.Len(enforced, 2)
+
+		// Both policies and the template share the nonce of the request.
+		check.Equal(enforced[0], nonce.FindString(rec.Header().Get(echo.HeaderContentSecurityPolicyReportOnly)))
+		check.Equal(`<script nonce="`+enforced[1]+`"></script>`, rec.Body.String())
+		check.Equal(`csp-endpoint="/csp-reports"`, rec.Header().Get(HeaderReportingEndpoints))
+
+		check.False(seen[enforced[1]])
+		seen[enforced[1]] = true
+	}
+
+	// Without RequestNonce there is no nonce.
+	mw, err = New(ContentSecurityPolicy(NewCSP().Add(DefaultSrc, Self)))
+	check.NoError(err)
+
+	e = echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, Nonce(c))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	check.Equal("default-src 'self'", rec.Header().Get(echo.HeaderContentSecurityPolicy))
+	check.Empty(rec.Body.String())
+}
@@ -0,0 +1,357 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var (
+	ErrSkipperNil     = errors.New("skipper is nil")
+	ErrInvalidHSTS    = errors.New("hsts preload requires a max age of at least a year and subdomains")
+	ErrInvalidValue   = errors.New("invalid header value")
+	ErrInvalidFeature = errors.New("invalid permissions policy feature")
+	ErrNilPolicy      = errors.New("content security policy is nil")
+)
+
+const (
+	HeaderPermissionsPolicy         = "Permissions-Policy"
+	HeaderCrossOriginOpenerPolicy   = "Cross-Origin-Opener-Policy"
+	HeaderCrossOriginEmbedderPolicy = "Cross-Origin-Embedder-Policy"
+	HeaderCrossOriginResourcePolicy = "Cross-Origin-Resource-Policy"
+	HeaderReportingEndpoints        = "Reporting-Endpoints"
+)
+
+// Referrer policies.
+const (
+	NoReferrer                  = "no-referrer"
+	NoReferrerWhenDowngrade     = "no-referrer-when-downgrade"
+	Origin                      = "origin"
+	OriginWhenCrossOrigin       = "origin-when-cross-origin"
+	SameOrigin                  = "same-origin"
+	StrictOrigin                = "strict-origin"
+	StrictOriginWhenCrossOrigin = "strict-origin-when-cross-origin"
+	UnsafeURL                   = "unsafe-url"
+)
+
+// Frame options.
+const (
+	FrameDeny       = "DENY"
+	FrameSameOrigin = "SAMEORIGIN"
+)
+
+// Cross origin opener policies.
+const (
+	OpenerUnsafeNone            = "unsafe-none"
+	OpenerSameOriginAllowPopups = "same-origin-allow-popups"
+	OpenerSameOrigin            = "same-origin"
+)
+
+// Cross origin embedder policies.
+const (
+	EmbedderUnsafeNone     = "unsafe-none"
+	EmbedderRequireCorp    = "require-corp"
+	EmbedderCredentialless = "credentialless"
+)
+
+// Cross origin resource policies.
+const (
+	ResourceSameSite    = "same-site"
+	ResourceSameOrigin  = "same-origin"
+	ResourceCrossOrigin = "cross-origin"
+)
+
+var feature = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+type config struct {
+	skipper     middleware.Skipper
+	hsts        string
+	noSniff     bool
+	referrer    string
+	frame       string
+	permissions []string
+	opener      string
+	embedder    string
+	resource    string
+	csp         *CSP
+	reportOnly  *CSP
+}
+
+type Option interface {
+	apply(*config) error
+}
+
+type option func(*config) error
+
+func (o option) apply(c *config) error {
+	return o(c)
+}
+
+// Skipper lets you use the skipper of your choice.
+func Skipper(sk middleware.Skipper) Option {
+	return option(func(c *config) error {
+
+		if sk == nil {
+			return ErrSkipperNil
+		}
+
+		c.skipper = sk
+
+		return nil
+	})
+}
+
+// HSTS tells browsers to only use HTTPS for maxAge. Preloading requires at least a year and subdomains.
+// A maxAge of zero tells browsers to forget the policy.
+func HSTS(maxAge time.Duration, subdomains, preload bool) Option {
+	return option(func(c *config) error {
+
+		if maxAge < 0 {
+			return ErrInvalidValue
+		}
+
+		if preload && (maxAge < 365*24*time.Hour || !subdomains) {
+			return ErrInvalidHSTS
+		}
+
+		c.hsts = fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+
+		if subdomains {
+			c.hsts += "; includeSubDomains"
+		}
+
+		if preload {
+			c.hsts += "; preload"
+		}
+
+		return nil
+	})
+}
+
+// AllowSniffing removes the X-Content-Type-Options header, which is nosniff by default.
+func AllowSniffing() Option {
+	return option(func(c *config) error {
+		c.noSniff = false
+		return nil
+	})
+}
+
+// ReferrerPolicy sets the Referrer-Policy, the default is StrictOriginWhenCrossOrigin.
+func ReferrerPolicy(policy string) Option {
+	return option(func(c *config) error {
+		return oneOf(&c.referrer, policy, NoReferrer, NoReferrerWhenDowngrade, Origin, OriginWhenCrossOrigin, SameOrigin, StrictOrigin, StrictOriginWhenCrossOrigin, UnsafeURL)
+	})
+}
+
+// FrameOptions sets the X-Frame-Options, the default is FrameSameOrigin. An empty value removes the header,
+// i.e. when the frame-ancestors directive of the content security policy is used instead.
+func FrameOptions(value string) Option {
+	return option(func(c *config) error {
+		return oneOf(&c.frame, value, "", FrameDeny, FrameSameOrigin)
+	})
+}
+
+// Permission adds a feature to the Permissions-Policy, allowed for the origins given,
+// i.e. Permission("camera") disables the camera and Permission("geolocation", "self", "https://maps.example.com") limits it.
+func Permission(name string, allowlist ...string) Option {
+	return option(func(c *config) error {
+
+		if !feature.MatchString(name) {
+			return ErrInvalidFeature
+		}
+
+		list := make([]string, len(allowlist))
+
+		for x, single := range allowlist {
+
+			switch {
+			case single == "self" || single == "*":
+				list[x] = single
+			case strings.ContainsAny(single, "\" ,;()") || single == "":
+				return ErrInvalidValue
+			default:
+				list[x] = `"` + single + `"`
+			}
+		}
+
+		c.permissions = append(c.permissions, name+"=("+strings.Join(list, " ")+")")
+
+		return nil
+	})
+}
+
+// CrossOriginOpenerPolicy sets the Cross-Origin-Opener-Policy, the default is OpenerSameOrigin. An empty value removes the header.
+func CrossOriginOpenerPolicy(policy string) Option {
+	return option(func(c *config) error {
+		return oneOf(&c.opener, policy, "", OpenerUnsafeNone, OpenerSameOriginAllowPopups, OpenerSameOrigin)
+	})
+}
+
+// CrossOriginEmbedderPolicy sets the Cross-Origin-Embedder-Policy, which is not sent by default.
+func CrossOriginEmbedderPolicy(policy string) Option {
+	return option(func(c *config) error {
+		return oneOf(&c.embedder, policy, "", EmbedderUnsafeNone, EmbedderRequireCorp, EmbedderCredentialless)
+	})
+}
+
+// CrossOriginResourcePolicy sets the Cross-Origin-Resource-Policy, the default is ResourceSameOrigin. An empty value removes the header.
+func CrossOriginResourcePolicy(policy string) Option {
+	return option(func(c *config) error {
+		return oneOf(&c.resource, policy, "", ResourceSameSite, ResourceSameOrigin, ResourceCrossOrigin)
+	})
+}
+
+// ContentSecurityPolicy enforces the policy.
+func ContentSecurityPolicy(policy *CSP) Option {
+	return option(func(c *config) error {
+
+		if policy == nil {
+			return ErrNilPolicy
+		}
+
+		if policy.err != nil {
+			return policy.err
+		}
+
+		c.csp = policy
+
+		return nil
+	})
+}
+
+// ContentSecurityPolicyReportOnly reports what the policy would block without blocking it,
+// it can be used together with ContentSecurityPolicy to try a stricter policy.
+func ContentSecurityPolicyReportOnly(policy *CSP) Option {
+	return option(func(c *config) error {
+
+		if policy == nil {
+			return ErrNilPolicy
+		}
+
+		if policy.err != nil {
+			return policy.err
+		}
+
+		c.reportOnly = policy
+
+		return nil
+	})
+}
+
+func oneOf(dst *string, value string, allowed ...string) error {
+
+	if !slices.Contains(allowed, value) {
+		return ErrInvalidValue
+	}
+
+	*dst = value
+
+	return nil
+}
+
+// New returns a middleware that sets the security headers on every response.
+// By default it sets X-Content-Type-Options, Referrer-Policy, X-Frame-Options, Cross-Origin-Opener-Policy and Cross-Origin-Resource-Policy.
+// HSTS and the content security policy are only sent when configured.
+func New(opts ...Option) (echo.MiddlewareFunc, error) {
+
+	var (
+		err error
+		c   = &config{
+			skipper:  middleware.DefaultSkipper,
+			noSniff:  true,
+			referrer: StrictOriginWhenCrossOrigin,
+			frame:    FrameSameOrigin,
+			opener:   OpenerSameOrigin,
+			resource: ResourceSameOrigin,
+		}
+	)
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(c))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The headers that do not change between requests.
+	static := map[string]string{
+		echo.HeaderStrictTransportSecurity: c.hsts,
+		echo.HeaderReferrerPolicy:          c.referrer,
+		echo.HeaderXFrameOptions:           c.frame,
+		HeaderPermissionsPolicy:            strings.Join(c.permissions, ", "),
+		HeaderCrossOriginOpenerPolicy:      c.opener,
+		HeaderCrossOriginEmbedderPolicy:    c.embedder,
+		HeaderCrossOriginResourcePolicy:    c.resource,
+	}
+
+	if c.noSniff {
+		static[echo.HeaderXContentTypeOptions] = "nosniff"
+	}
+
+	var endpoints []string
+
+	for _, policy := range []*CSP{c.csp, c.reportOnly} {
+		if policy != nil && policy.endpoint != "" && !slices.Contains(endpoints, policy.endpoint) {
+			endpoints = append(endpoints, policy.endpoint)
+		}
+	}
+
+	for x, endpoint := range endpoints {
+		endpoints[x] = reportGroup + `="` + endpoint + `"`
+	}
+
+	static[HeaderReportingEndpoints] = strings.Join(endpoints, ", ")
+
+	for key, value := range static {
+		if value == "" {
+			delete(static, key)
+		}
+	}
+
+	nonce := c.csp.usesNonce() || c.reportOnly.usesNonce()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+
+			if c.skipper(ctx) {
+				return next(ctx)
+			}
+
+			h := ctx.Response().Header()
+
+			for key, value := range static {
+				h.Set(key, value)
+			}
+
+			var value string
+
+			if nonce {
+
+				generated, err := generate()
+				if err != nil {
+					return err
+				}
+
+				value = generated
+				ctx.Set(ContextKey, value)
+			}
+
+			if c.csp != nil {
+				h.Set(echo.HeaderContentSecurityPolicy, c.csp.render(value))
+			}
+
+			if c.reportOnly != nil {
+				h.Set(echo.HeaderContentSecurityPolicyReportOnly, c.reportOnly.render(value))
+			}
+
+			return next(ctx)
+		}
+	}, nil
+}
@@ -0,0 +1,106 @@
+package headers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		args    []Option
+		wantErr error
+	}{
+		{name: "default"},
+		{name: "nil skipper", args: []Option{Skipper(nil)}, wantErr: ErrSkipperNil},
+		{name: "hsts", args: []Option{HSTS(2*365*24*time.Hour, true, true)}},
+		{name: "hsts short preload", args: []Option{HSTS(time.Hour, true, true)}, wantErr: ErrInvalidHSTS},
+		{name: "hsts preload without subdomains", args: []Option{HSTS(2*365*24*time.Hour, false, true)}, wantErr: ErrInvalidHSTS},
+		{name: "hsts negative", args: []Option{HSTS(-time.Hour, false, false)}, wantErr: ErrInvalidValue},
+		{name: "referrer", args: []Option{ReferrerPolicy("everywhere")}, wantErr: ErrInvalidValue},
+		{name: "frame", args: []Option{FrameOptions("ALLOW-FROM https://example.com")}, wantErr: ErrInvalidValue},
+		{name: "opener", args: []Option{CrossOriginOpenerPolicy("same-site")}, wantErr: ErrInvalidValue},
+		{name: "embedder", args: []Option{CrossOriginEmbedderPolicy(EmbedderRequireCorp)}},
+		{name: "feature", args: []Option{Permission("Camera")}, wantErr: ErrInvalidFeature},
+		{name: "allowlist", args: []Option{Permission("camera", `https://a.test" x`)}, wantErr: ErrInvalidValue},
+		{name: "nil policy", args: []Option{ContentSecurityPolicy(nil)}, wantErr: ErrNilPolicy},
+		{name: "invalid policy", args: []Option{ContentSecurityPolicyReportOnly(NewCSP().Add(ScriptSrc, "'self'; img-src *"))}, wantErr: ErrInvalidSource},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			_, err := New(tt.args...)
+			if tt.wantErr != nil {
+				check.ErrorIs(err, tt.wantErr)
+			} else {
+				check.NoError(err)
+			}
+
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+
+	check := require.New(t)
+
+	serve := func(opts ...Option) http.Header {
+
+		mw, err := New(opts...)
+		check.NoError(err)
+
+		e := echo.New()
+		e.Use(mw)
+		e.GET("/", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		return rec.Header()
+	}
+
+	h := serve()
+	check.Equal("nosniff", h.Get(echo.HeaderXContentTypeOptions))
+	check.Equal(StrictOriginWhenCrossOrigin, h.Get(echo.HeaderReferrerPolicy))
+	check.Equal(FrameSameOrigin, h.Get(echo.HeaderXFrameOptions))
+	check.Equal(OpenerSameOrigin, h.Get(HeaderCrossOriginOpenerPolicy))
+	check.Equal(ResourceSameOrigin, h.Get(HeaderCrossOriginResourcePolicy))
+
+	for _, key := range []string{echo.HeaderStrictTransportSecurity, echo.HeaderContentSecurityPolicy, HeaderPermissionsPolicy, HeaderCrossOriginEmbedderPolicy, HeaderReportingEndpoints} {
+		check.NotContains(h, key)
+	}
+
+	h = serve(
+		HSTS(2*365*24*time.Hour, true, true),
+		AllowSniffing(),
+		ReferrerPolicy(NoReferrer),
+		FrameOptions(""),
+		Permission("camera"),
+		Permission("geolocation", "self", "https://maps.example.com"),
+		CrossOriginEmbedderPolicy(EmbedderRequireCorp),
+		CrossOriginResourcePolicy(ResourceCrossOrigin),
+	)
+
+	check.Equal("max-age=63072000; includeSubDomains; preload", h.Get(echo.HeaderStrictTransportSecurity))
+	check.NotContains(h, echo.HeaderXContentTypeOptions)
+	check.NotContains(h, echo.HeaderXFrameOptions)
+	check.Equal(NoReferrer, h.Get(echo.HeaderReferrerPolicy))
+	check.Equal(`camera=(), geolocation=(self "https://maps.example.com")`, h.Get(HeaderPermissionsPolicy))
+	check.Equal(EmbedderRequireCorp, h.Get(HeaderCrossOriginEmbedderPolicy))
+	check.Equal(ResourceCrossOrigin, h.Get(HeaderCrossOriginResourcePolicy))
+
+	// Skipped requests get nothing.
+	h = serve(Skipper(func(echo.Context) bool { return true }))
+	check.NotContains(h, echo.HeaderXContentTypeOptions)
+}
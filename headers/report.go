@@ -0,0 +1,204 @@
+package headers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrNilLogger  = errors.New("logger is nil")
+	ErrReportRate = errors.New("report rate and burst must be positive")
+)
+
+const (
+	// maxReportSize bounds the body of a report, anyone can send one.
+	maxReportSize = 64 << 10
+
+	// maxLoggedReports bounds the violations logged for one request, the others are only counted.
+	maxLoggedReports = 10
+)
+
+// ReportOption configures ReportHandler.
+type ReportOption func(*reportConfig) error
+
+type reportConfig struct {
+	limit rate.Limit
+	burst int
+}
+
+// ReportRate sets how many reports per second are accepted, with bursts of burst reports.
+// Reports past it are answered with 429 and not logged. The default is 10 per second with bursts of 50.
+func ReportRate(limit rate.Limit, burst int) ReportOption {
+	return func(c *reportConfig) error {
+
+		if limit <= 0 || burst < 1 {
+			return ErrReportRate
+		}
+
+		c.limit = limit
+		c.burst = burst
+
+		return nil
+	}
+}
+
+// violation is a report in either format, using the names of the Reporting API.
+type violation struct {
+	DocumentURL        string `json:"documentURL"`
+	Referrer           string `json:"referrer"`
+	BlockedURL         string `json:"blockedURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	OriginalPolicy     string `json:"originalPolicy"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"sourceFile"`
+	LineNumber         int    `json:"lineNumber"`
+	ColumnNumber       int    `json:"columnNumber"`
+	Sample             string `json:"sample"`
+	StatusCode         int    `json:"statusCode"`
+}
+
+// legacy is the report-uri format.
+type legacy struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		ScriptSample       string `json:"script-sample"`
+		StatusCode         int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// report is one entry of the Reporting API format.
+type report struct {
+	Type      string    `json:"type"`
+	UserAgent string    `json:"user_agent"`
+	Body      violation `json:"body"`
+}
+
+func (v violation) attr() slog.Attr {
+	return slog.Group("csp",
+		slog.String("document", v.DocumentURL),
+		slog.String("blocked", v.BlockedURL),
+		slog.String("directive", v.EffectiveDirective),
+		slog.String("disposition", v.Disposition),
+		slog.String("source", v.SourceFile),
+		slog.Int("line", v.LineNumber),
+		slog.Int("column", v.ColumnNumber),
+		slog.String("sample", v.Sample),
+	)
+}
+
+// ReportHandler logs the content security policy violations sent by browsers, in both the
+// report-uri (application/csp-report) and report-to (application/reports+json) formats. Mount it on POST.
+// Anyone can send reports, so they are rate limited and only the first few violations of a request are logged.
+func ReportHandler(logger *slog.Logger, opts ...ReportOption) (echo.HandlerFunc, error) {
+
+	if logger == nil {
+		return nil, ErrNilLogger
+	}
+
+	cfg := reportConfig{
+		limit: 10,
+		burst: 50,
+	}
+
+	var err error
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt(&cfg))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := rate.NewLimiter(cfg.limit, cfg.burst)
+
+	return func(c echo.Context) error {
+
+		if !limiter.Allow() {
+			return echo.NewHTTPError(http.StatusTooManyRequests)
+		}
+
+		media, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxReportSize))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge)
+		}
+
+		var found []violation
+
+		switch media {
+		case "application/csp-report", echo.MIMEApplicationJSON:
+
+			var single legacy
+			if err := json.Unmarshal(body, &single); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest)
+			}
+
+			r := single.Report
+
+			directive := r.EffectiveDirective
+			if directive == "" {
+				directive = r.ViolatedDirective
+			}
+
+			found = append(found, violation{
+				DocumentURL:        r.DocumentURI,
+				Referrer:           r.Referrer,
+				BlockedURL:         r.BlockedURI,
+				EffectiveDirective: directive,
+				OriginalPolicy:     r.OriginalPolicy,
+				Disposition:        r.Disposition,
+				SourceFile:         r.SourceFile,
+				LineNumber:         r.LineNumber,
+				ColumnNumber:       r.ColumnNumber,
+				Sample:             r.ScriptSample,
+				StatusCode:         r.StatusCode,
+			})
+
+		case "application/reports+json":
+
+			var list []report
+			if err := json.Unmarshal(body, &list); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest)
+			}
+
+			for _, r := range list {
+				if r.Type == "csp-violation" {
+					found = append(found, r.Body)
+				}
+			}
+
+		default:
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType)
+		}
+
+		for x, v := range found {
+
+			if x == maxLoggedReports {
+				logger.LogAttrs(c.Request().Context(), slog.LevelWarn, "content security policy violations not logged", slog.Int("amount", len(found)-x))
+				break
+			}
+
+			logger.LogAttrs(c.Request().Context(), slog.LevelWarn, "content security policy violation", v.attr(), slog.String("user_agent", c.Request().UserAgent()))
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}, nil
+}
@@ -0,0 +1,126 @@
+package headers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportHandler(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := ReportHandler(nil)
+	check.ErrorIs(err, ErrNilLogger)
+
+	var buf bytes.Buffer
+
+	handler, err := ReportHandler(slog.New(slog.NewTextHandler(&buf, nil)))
+	check.NoError(err)
+
+	e := echo.New()
+	e.POST("/csp-reports", handler)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        []string
+	}{
+		{
+			name:        "report-uri",
+			contentType: "application/csp-report",
+			body:        `{"csp-report":{"document-uri":"https://app.example.com/","violated-directive":"script-src","blocked-uri":"https://evil.test/x.js","disposition":"enforce","line-number":3}}`,
+			status:      http.StatusNoContent,
+			want:        []string{"csp.document=https://app.example.com/", "csp.blocked=https://evil.test/x.js", "csp.directive=script-src", "csp.line=3"},
+		},
+		{
+			name:        "report-to",
+			contentType: "application/reports+json",
+			body:        `[{"type":"csp-violation","body":{"documentURL":"https://app.example.com/a","blockedURL":"inline","effectiveDirective":"style-src-elem","disposition":"report"}},{"type":"deprecation","body":{}}]`,
+			status:      http.StatusNoContent,
+			want:        []string{"csp.document=https://app.example.com/a", "csp.blocked=inline", "csp.directive=style-src-elem", "csp.disposition=report"},
+		},
+		{name: "malformed", contentType: "application/csp-report", body: `{`, status: http.StatusBadRequest},
+		{name: "unsupported", contentType: "text/plain", body: `hello`, status: http.StatusUnsupportedMediaType},
+		{name: "too large", contentType: "application/csp-report", body: strings.Repeat(" ", maxReportSize+1), status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			buf.Reset()
+
+			req := httptest.NewRequest(http.MethodPost, "/csp-reports", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			check.Equal(tt.status, rec.Code)
+
+			for _, want := range tt.want {
+				check.Contains(buf.String(), want)
+			}
+
+			if tt.want == nil {
+				check.Empty(buf.String())
+			} else {
+				check.Equal(1, strings.Count(buf.String(), "content security policy violation"))
+			}
+
+		})
+	}
+}
+
+func TestReportHandlerLimits(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := ReportHandler(slog.Default(), ReportRate(0, 1))
+	check.ErrorIs(err, ErrReportRate)
+
+	var buf bytes.Buffer
+
+	handler, err := ReportHandler(slog.New(slog.NewTextHandler(&buf, nil)), ReportRate(0.001, 2))
+	check.NoError(err)
+
+	e := echo.New()
+	e.POST("/csp-reports", handler)
+
+	// One request with many violations logs the first few and how many were left out.
+	report := `{"type":"csp-violation","body":{"documentURL":"https://app.example.com/","blockedURL":"inline","effectiveDirective":"script-src"}}`
+	body := "[" + strings.TrimSuffix(strings.Repeat(report+",", maxLoggedReports+5), ",") + "]"
+
+	send := func(body string) int {
+
+		req := httptest.NewRequest(http.MethodPost, "/csp-reports", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, "application/reports+json")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	check.Equal(http.StatusNoContent, send(body))
+	check.Equal(maxLoggedReports, strings.Count(buf.String(), "msg=\"content security policy violation\""))
+	check.Contains(buf.String(), "msg=\"content security policy violations not logged\" amount=5")
+
+	// Past the burst, reports are refused without being logged.
+	check.Equal(http.StatusNoContent, send("["+report+"]"))
+
+	buf.Reset()
+
+	check.Equal(http.StatusTooManyRequests, send("["+report+"]"))
+	check.Empty(buf.String())
+}
@@ -0,0 +1,29 @@
+package reverb
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hcarriz/reverb/health"
+)
+
+// Errors
+var (
+	ErrMissingHealth = errors.New("missing health")
+)
+
+// Health serves the liveness checks on /healthz and every check on /readyz, see the health package.
+// Give h.Service to graceful.Run so readiness fails as soon as the shutdown starts.
+func Health(h *health.Health) Option {
+	return option(func(c *config) error {
+
+		if h == nil {
+			return ErrMissingHealth
+		}
+
+		c.echo.Add(http.MethodGet, "/healthz", h.Liveness)
+		c.echo.Add(http.MethodGet, "/readyz", h.Readiness)
+
+		return nil
+	})
+}
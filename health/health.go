@@ -0,0 +1,361 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hcarriz/reverb/graceful"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrEmptyName       = errors.New("check name is empty")
+	ErrNilCheck        = errors.New("check is nil")
+	ErrDuplicateCheck  = errors.New("check name is already used")
+	ErrInvalidDuration = errors.New("invalid duration")
+	ErrNilLogger       = errors.New("logger is nil")
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// CheckFunc reports a problem with a dependency, it should return when ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+// Pinger is satisfied by *sql.DB, i.e. the one given to ent with entsql.OpenDB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Ping checks that the database is reachable. A nil db, including a nil *sql.DB, gives a nil CheckFunc,
+// which Live and Ready reject with ErrNilCheck.
+func Ping(db Pinger) CheckFunc {
+
+	if db == nil {
+		return nil
+	}
+
+	if v := reflect.ValueOf(db); v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+
+	return db.PingContext
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+	live bool
+
+	mu  sync.Mutex
+	err error
+	at  time.Time
+}
+
+type Option interface {
+	apply(*Health) error
+}
+
+type option func(*Health) error
+
+func (o option) apply(h *Health) error {
+	return o(h)
+}
+
+// Live adds a check to both /healthz and /readyz. A failing liveness check gets the process restarted,
+// so only use it for problems a restart fixes.
+func Live(name string, fn CheckFunc) Option {
+	return option(func(h *Health) error {
+		return h.add(name, fn, true)
+	})
+}
+
+// Ready adds a check to /readyz, i.e. the database or the session store.
+func Ready(name string, fn CheckFunc) Option {
+	return option(func(h *Health) error {
+		return h.add(name, fn, false)
+	})
+}
+
+// Timeout bounds every check, the default is 2 seconds.
+func Timeout(duration time.Duration) Option {
+	return option(func(h *Health) error {
+
+		if duration <= 0 {
+			return ErrInvalidDuration
+		}
+
+		h.timeout = duration
+
+		return nil
+	})
+}
+
+// Cache reuses the result of a check for duration, so probes do not hammer the dependencies. The default is 1 second, zero disables it.
+func Cache(duration time.Duration) Option {
+	return option(func(h *Health) error {
+
+		if duration < 0 {
+			return ErrInvalidDuration
+		}
+
+		h.cache = duration
+
+		return nil
+	})
+}
+
+// DrainDelay is how long the graceful.Service waits after failing readiness, so the load balancer
+// stops sending traffic before the services it depends on close. The default is 5 seconds.
+func DrainDelay(duration time.Duration) Option {
+	return option(func(h *Health) error {
+
+		if duration < 0 {
+			return ErrInvalidDuration
+		}
+
+		h.delay = duration
+
+		return nil
+	})
+}
+
+// Logger sets where failing checks are logged, the default is slog.Default.
+func Logger(logger *slog.Logger) Option {
+	return option(func(h *Health) error {
+
+		if logger == nil {
+			return ErrNilLogger
+		}
+
+		h.logger = logger
+
+		return nil
+	})
+}
+
+// Health aggregates checks into liveness and readiness endpoints.
+type Health struct {
+	checks   []*check
+	timeout  time.Duration
+	cache    time.Duration
+	delay    time.Duration
+	logger   *slog.Logger
+	draining atomic.Bool
+}
+
+// New returns a Health with the checks of the options.
+func New(opts ...Option) (*Health, error) {
+
+	var (
+		err error
+		h   = &Health{
+			timeout: 2 * time.Second,
+			cache:   time.Second,
+			delay:   5 * time.Second,
+			logger:  slog.Default(),
+		}
+	)
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(h))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *Health) add(name string, fn CheckFunc, live bool) error {
+
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	if fn == nil {
+		return ErrNilCheck
+	}
+
+	for _, c := range h.checks {
+		if c.name == name {
+			return ErrDuplicateCheck
+		}
+	}
+
+	h.checks = append(h.checks, &check{name: name, fn: fn, live: live})
+
+	return nil
+}
+
+// Drain fails readiness from now on, liveness is not affected.
+func (h *Health) Drain() {
+	if !h.draining.Swap(true) {
+		h.logger.Info("draining")
+	}
+}
+
+// Draining reports if Drain was called.
+func (h *Health) Draining() bool {
+	return h.draining.Load()
+}
+
+// run returns the result of the check, from the cache when it is recent enough.
+// Concurrent probes wait for the same run instead of starting their own, so the check does not stop
+// when the probe that started it goes away, and a cancellation is never cached for the others.
+func (h *Health) run(ctx context.Context, c *check) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if h.cache > 0 && !c.at.IsZero() && time.Since(c.at) < h.cache {
+		return c.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	err := c.fn(ctx)
+	end := time.Now()
+
+	if err != nil {
+		h.logger.LogAttrs(ctx, slog.LevelWarn, "health check failed", slog.String("check", c.name), slog.Duration("duration", end.Sub(start)), slog.String("error", err.Error()))
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	c.err = err
+	c.at = end
+
+	return c.err
+}
+
+// Report is the body of the endpoints.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// report runs the checks concurrently, only the liveness ones unless ready is set.
+func (h *Health) report(ctx context.Context, ready bool) Report {
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+		r  = Report{Status: StatusOK, Checks: make(map[string]string)}
+	)
+
+	for _, c := range h.checks {
+
+		if !c.live && !ready {
+			continue
+		}
+
+		c := c
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			status := StatusOK
+			if err := h.run(ctx, c); err != nil {
+				status = StatusFail
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			r.Checks[c.name] = status
+
+			if status == StatusFail {
+				r.Status = StatusFail
+			}
+
+		}()
+	}
+
+	wg.Wait()
+
+	if ready && h.Draining() {
+		r.Status = StatusDraining
+	}
+
+	return r
+}
+
+func (h *Health) respond(c echo.Context, ready bool) error {
+
+	r := h.report(c.Request().Context(), ready)
+
+	code := http.StatusOK
+	if r.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	return c.JSON(code, r)
+}
+
+// Liveness is the handler for /healthz, it runs the Live checks.
+func (h *Health) Liveness(c echo.Context) error {
+	return h.respond(c, false)
+}
+
+// Readiness is the handler for /readyz, it runs every check and fails once draining.
+func (h *Health) Readiness(c echo.Context) error {
+	return h.respond(c, true)
+}
+
+// Service drains when graceful starts the shutdown, then waits for the DrainDelay before it is closed.
+// dependsOn names the services that must keep serving meanwhile, usually the HTTP server:
+//
+//	graceful.Run(ctx, []graceful.Service{server, h.Service("http")})
+func (h *Health) Service(dependsOn ...string) graceful.Service {
+
+	stop := make(chan struct{})
+	once := sync.Once{}
+
+	return graceful.Service{
+		Name:      "health",
+		DependsOn: dependsOn,
+		// Waiting out the delay is not a timeout.
+		Timeout: h.delay + time.Second,
+		Start: func() error {
+			<-stop
+			return nil
+		},
+		Close: func(ctx context.Context) error {
+
+			defer once.Do(func() { close(stop) })
+
+			h.Drain()
+
+			timer := time.NewTimer(h.delay)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
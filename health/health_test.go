@@ -0,0 +1,215 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/graceful"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+
+	ok := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name    string
+		args    []Option
+		wantErr error
+	}{
+		{name: "default"},
+		{name: "empty name", args: []Option{Ready("", ok)}, wantErr: ErrEmptyName},
+		{name: "nil check", args: []Option{Live("db", nil)}, wantErr: ErrNilCheck},
+		{name: "nil pinger", args: []Option{Ready("db", Ping(nil))}, wantErr: ErrNilCheck},
+		{name: "nil database", args: []Option{Ready("db", Ping((*sql.DB)(nil)))}, wantErr: ErrNilCheck},
+		{name: "duplicate", args: []Option{Live("db", ok), Ready("db", ok)}, wantErr: ErrDuplicateCheck},
+		{name: "timeout", args: []Option{Timeout(0)}, wantErr: ErrInvalidDuration},
+		{name: "cache", args: []Option{Cache(-time.Second)}, wantErr: ErrInvalidDuration},
+		{name: "delay", args: []Option{DrainDelay(-time.Second)}, wantErr: ErrInvalidDuration},
+		{name: "logger", args: []Option{Logger(nil)}, wantErr: ErrNilLogger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			_, err := New(tt.args...)
+			if tt.wantErr != nil {
+				check.ErrorIs(err, tt.wantErr)
+			} else {
+				check.NoError(err)
+			}
+
+		})
+	}
+}
+
+func serve(t *testing.T, h *Health, path string) (int, Report) {
+
+	e := echo.New()
+	e.GET("/healthz", h.Liveness)
+	e.GET("/readyz", h.Readiness)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var r Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+
+	return rec.Code, r
+}
+
+func TestEndpoints(t *testing.T) {
+
+	check := require.New(t)
+
+	var (
+		failing atomic.Bool
+		calls   atomic.Int32
+	)
+
+	h, err := New(
+		Cache(0),
+		Live("loop", func(context.Context) error { return nil }),
+		Ready("db", func(context.Context) error {
+			calls.Add(1)
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+		Ready("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		Timeout(20*time.Millisecond),
+	)
+	check.NoError(err)
+
+	// Liveness only runs the live checks.
+	code, r := serve(t, h, "/healthz")
+	check.Equal(http.StatusOK, code)
+	check.Equal(Report{Status: StatusOK, Checks: map[string]string{"loop": StatusOK}}, r)
+	check.Zero(calls.Load())
+
+	// The slow check times out.
+	code, r = serve(t, h, "/readyz")
+	check.Equal(http.StatusServiceUnavailable, code)
+	check.Equal(Report{Status: StatusFail, Checks: map[string]string{"loop": StatusOK, "db": StatusOK, "slow": StatusFail}}, r)
+
+	failing.Store(true)
+
+	_, r = serve(t, h, "/readyz")
+	check.Equal(StatusFail, r.Checks["db"])
+
+	// Draining fails readiness but not liveness.
+	h, err = New()
+	check.NoError(err)
+
+	code, _ = serve(t, h, "/readyz")
+	check.Equal(http.StatusOK, code)
+
+	h.Drain()
+
+	code, r = serve(t, h, "/readyz")
+	check.Equal(http.StatusServiceUnavailable, code)
+	check.Equal(StatusDraining, r.Status)
+
+	code, _ = serve(t, h, "/healthz")
+	check.Equal(http.StatusOK, code)
+}
+
+func TestCache(t *testing.T) {
+
+	check := require.New(t)
+
+	var calls atomic.Int32
+
+	h, err := New(Cache(time.Hour), Ready("db", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}))
+	check.NoError(err)
+
+	for x := 0; x < 5; x++ {
+		code, _ := serve(t, h, "/readyz")
+		check.Equal(http.StatusOK, code)
+	}
+
+	check.EqualValues(1, calls.Load())
+}
+
+func TestCacheCanceledProbe(t *testing.T) {
+
+	check := require.New(t)
+
+	var calls atomic.Int32
+
+	h, err := New(Cache(time.Hour), Ready("db", func(ctx context.Context) error {
+		calls.Add(1)
+		return ctx.Err()
+	}))
+	check.NoError(err)
+
+	// The probe went away before the check ran, the check does not see it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	check.Equal(StatusOK, h.report(ctx, true).Status)
+	check.Equal(StatusOK, h.report(context.Background(), true).Status)
+	check.EqualValues(1, calls.Load())
+
+	// A check that is cancelled on its own is not cached.
+	h, err = New(Cache(time.Hour), Ready("db", func(context.Context) error {
+		calls.Add(1)
+		return context.Canceled
+	}))
+	check.NoError(err)
+
+	calls.Store(0)
+
+	check.Equal(StatusFail, h.report(context.Background(), true).Status)
+	check.Equal(StatusFail, h.report(context.Background(), true).Status)
+	check.EqualValues(2, calls.Load())
+}
+
+func TestService(t *testing.T) {
+
+	check := require.New(t)
+
+	h, err := New(DrainDelay(50 * time.Millisecond))
+	check.NoError(err)
+
+	var drained atomic.Bool
+
+	// The server keeps serving while the health service drains.
+	stop := make(chan struct{})
+	server := graceful.Service{
+		Name:  "http",
+		Start: func() error { <-stop; return nil },
+		Close: func(context.Context) error {
+			drained.Store(h.Draining())
+			close(stop)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+
+	check.NoError(graceful.Run(ctx, []graceful.Service{server, h.Service("http")}))
+
+	check.True(drained.Load())
+	check.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,73 @@
+package password
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var ErrInvalidTarget = errors.New("target duration must be positive")
+
+const (
+	minCalibratedMemory     = 8 * 1024
+	maxCalibratedIterations = 64
+)
+
+// Calibration is the cost found by Calibrate.
+type Calibration struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	Took        time.Duration // How long one hash took with these parameters.
+}
+
+// Options returns the options that hash with the calibrated cost.
+func (c Calibration) Options() []Option {
+	return []Option{Memory(c.Memory), Iterations(c.Iterations), Parallelism(c.Parallelism)}
+}
+
+// Calibrate finds the cost that makes one hash take about target on this machine.
+// It starts from the memory, iterations and parallelism in opts, halving the memory while hashing is too slow
+// (down to 8 MiB) and then adding iterations until it is slow enough. It is meant to run once, i.e. at deploy time.
+func Calibrate(target time.Duration, opts ...Option) (Calibration, error) {
+
+	if target <= 0 {
+		return Calibration{}, ErrInvalidTarget
+	}
+
+	c, err := newConfig(opts...)
+	if err != nil {
+		return Calibration{}, err
+	}
+
+	salt, err := generatedBytes(c.saltLength)
+	if err != nil {
+		return Calibration{}, err
+	}
+
+	measure := func() time.Duration {
+		start := time.Now()
+		argon2.IDKey([]byte("calibration"), salt, c.iterations, c.memory, c.parallelism, c.keyLength)
+		return time.Since(start)
+	}
+
+	took := measure()
+
+	for took > target && c.memory/2 >= minCalibratedMemory {
+		c.memory /= 2
+		took = measure()
+	}
+
+	for took < target && c.iterations < maxCalibratedIterations {
+		c.iterations++
+		took = measure()
+	}
+
+	return Calibration{
+		Memory:      c.memory,
+		Iterations:  c.iterations,
+		Parallelism: c.parallelism,
+		Took:        took,
+	}, nil
+}
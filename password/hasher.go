@@ -0,0 +1,375 @@
+package password
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrUnknownAlgorithm  = errors.New("unknown hashing algorithm")
+	ErrInvalidParameters = errors.New("invalid hashing parameters")
+)
+
+// Result is the outcome of verifying a password.
+type Result struct {
+	// Match is set when the password is correct.
+	Match bool
+	// Outdated is set when the hash uses another algorithm than the current one, or weaker parameters.
+	// The password should be hashed again once it matches.
+	Outdated bool
+}
+
+// Hasher is a password hashing algorithm.
+type Hasher interface {
+	// Identify reports if the hash was made by the algorithm.
+	Identify(hash string) bool
+	// Hash hashes the plaintext with the current parameters.
+	Hash(plaintext string) (string, error)
+	// Verify compares the plaintext with the hash, reporting if the hash is weaker than the current parameters.
+	Verify(plaintext, hash string) (Result, error)
+}
+
+// Registry hashes new passwords with one algorithm and verifies hashes made by any of the known ones.
+type Registry struct {
+	hashers []Hasher
+}
+
+// NewRegistry returns a Registry that hashes with current and also verifies hashes made by legacy.
+func NewRegistry(current Hasher, legacy ...Hasher) *Registry {
+	return &Registry{hashers: append([]Hasher{current}, legacy...)}
+}
+
+// Hash hashes the plaintext with the current algorithm. Empty passwords are rejected.
+func (r *Registry) Hash(plaintext string) (string, error) {
+
+	if plaintext == "" {
+		return "", ErrEmptyPassword
+	}
+
+	return r.hashers[0].Hash(plaintext)
+}
+
+// Verify compares the plaintext with a hash made by any known algorithm.
+// Hashes that were not made by the current algorithm are always outdated.
+func (r *Registry) Verify(plaintext, hash string) (Result, error) {
+
+	for x, h := range r.hashers {
+
+		if !h.Identify(hash) {
+			continue
+		}
+
+		result, err := h.Verify(plaintext, hash)
+		if err != nil {
+			return Result{}, err
+		}
+
+		if x > 0 {
+			result.Outdated = true
+		}
+
+		return result, nil
+	}
+
+	return Result{}, ErrUnknownAlgorithm
+}
+
+// verifyNormalized verifies the NFKC form of the plaintext, which is what every Hasher hashes.
+// Hashes made before passwords were normalized are then tried with the plaintext as it is, and are outdated.
+func verifyNormalized(plaintext string, verify func(string) (Result, error)) (Result, error) {
+
+	normalized := Normalize(plaintext)
+
+	result, err := verify(normalized)
+	if err != nil || result.Match || normalized == plaintext {
+		return result, err
+	}
+
+	result, err = verify(plaintext)
+	if result.Match {
+		result.Outdated = true
+	}
+
+	return result, err
+}
+
+// Default hashes with argon2id and verifies argon2id, bcrypt, scrypt and PBKDF2-SHA256 hashes.
+var Default = NewRegistry(Argon2(), Bcrypt(12), Scrypt(15, 8, 1), PBKDF2SHA256(600_000))
+
+// Hash hashes the plaintext using Default.
+func Hash(plaintext string) (string, error) {
+	return Default.Hash(plaintext)
+}
+
+// Verify compares the plaintext and the hash using Default.
+func Verify(plaintext, hash string) (Result, error) {
+	return Default.Verify(plaintext, hash)
+}
+
+type argon2Hasher struct {
+	opts []Option
+}
+
+// Argon2 hashes with argon2id, as Create does with the same options.
+func Argon2(opts ...Option) Hasher {
+	return argon2Hasher{opts: opts}
+}
+
+func (a argon2Hasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$"+Variant+"$")
+}
+
+func (a argon2Hasher) Hash(plaintext string) (string, error) {
+
+	p, err := Create(plaintext, a.opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return p.String(), nil
+}
+
+func (a argon2Hasher) Verify(plaintext, hash string) (Result, error) {
+
+	c, err := newConfig(a.opts...)
+	if err != nil {
+		return Result{}, err
+	}
+
+	p, err := Parse(hash)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return verifyNormalized(plaintext, func(input string) (Result, error) {
+
+		match, err := compareKey(input, *p, a.opts...)
+		if err != nil {
+			return Result{}, err
+		}
+
+		return Result{
+			Match: match,
+			Outdated: p.Memory < c.memory || p.Iterations < c.iterations || p.Parallelism < c.parallelism ||
+				len(p.Salt) < c.saltLength || len(p.Key) < int(c.keyLength) || p.PepperID != c.currentPepper(),
+		}, nil
+	})
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+// Bcrypt hashes with bcrypt at the given cost.
+func Bcrypt(cost int) Hasher {
+	return bcryptHasher{cost: cost}
+}
+
+func (b bcryptHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b bcryptHasher) Hash(plaintext string) (string, error) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(Normalize(plaintext)), b.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b bcryptHasher) Verify(plaintext, hash string) (Result, error) {
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return Result{}, ErrInvalidHash
+	}
+
+	return verifyNormalized(plaintext, func(input string) (Result, error) {
+
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(input))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return Result{}, nil
+		}
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		return Result{Match: true, Outdated: cost < b.cost}, nil
+	})
+}
+
+type scryptHasher struct {
+	logN, r, p int
+}
+
+// Scrypt hashes with scrypt using N = 2^logN, in the PHC format "$scrypt$ln=15,r=8,p=1$salt$key".
+func Scrypt(logN, r, p int) Hasher {
+	return scryptHasher{logN: logN, r: r, p: p}
+}
+
+func (s scryptHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$scrypt$")
+}
+
+func (s scryptHasher) Hash(plaintext string) (string, error) {
+
+	if s.logN < 1 || s.logN > 30 || s.r < 1 || s.p < 1 {
+		return "", ErrInvalidParameters
+	}
+
+	salt, err := generatedBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(Normalize(plaintext)), salt, 1<<s.logN, s.r, s.p, 32)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", s.logN, s.r, s.p, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (s scryptHasher) Verify(plaintext, hash string) (Result, error) {
+
+	vals := strings.Split(hash, "$")
+	if len(vals) != 5 {
+		return Result{}, ErrInvalidHash
+	}
+
+	var found scryptHasher
+	if _, err := fmt.Sscanf(vals[2], "ln=%d,r=%d,p=%d", &found.logN, &found.r, &found.p); err != nil {
+		return Result{}, ErrInvalidHash
+	}
+
+	if found.logN < 1 || found.logN > 30 {
+		return Result{}, ErrInvalidHash
+	}
+
+	salt, key, err := decodeSaltAndKey(vals[3], vals[4], base64.RawStdEncoding)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return verifyNormalized(plaintext, func(input string) (Result, error) {
+
+		maybe, err := scrypt.Key([]byte(input), salt, 1<<found.logN, found.r, found.p, len(key))
+		if err != nil {
+			return Result{}, err
+		}
+
+		return Result{
+			Match:    subtle.ConstantTimeCompare(key, maybe) == 1,
+			Outdated: found.logN < s.logN || found.r < s.r || found.p < s.p,
+		}, nil
+	})
+}
+
+type pbkdf2Hasher struct {
+	iterations int
+}
+
+// PBKDF2SHA256 hashes with PBKDF2-HMAC-SHA256 in the PHC format "$pbkdf2-sha256$i=600000$salt$key".
+// It also verifies the passlib format "$pbkdf2-sha256$29000$salt$key", which uses adapted base64.
+func PBKDF2SHA256(iterations int) Hasher {
+	return pbkdf2Hasher{iterations: iterations}
+}
+
+func (p pbkdf2Hasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$pbkdf2-sha256$")
+}
+
+func (p pbkdf2Hasher) Hash(plaintext string) (string, error) {
+
+	if p.iterations < 1 {
+		return "", ErrInvalidParameters
+	}
+
+	salt, err := generatedBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(Normalize(plaintext)), salt, p.iterations, 32, sha256.New)
+
+	return fmt.Sprintf("$pbkdf2-sha256$i=%d$%s$%s", p.iterations, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (p pbkdf2Hasher) Verify(plaintext, hash string) (Result, error) {
+
+	vals := strings.Split(hash, "$")
+	if len(vals) != 5 {
+		return Result{}, ErrInvalidHash
+	}
+
+	var (
+		iterations int
+		err        error
+		salt, key  []byte
+	)
+
+	if rounds, ok := strings.CutPrefix(vals[2], "i="); ok {
+
+		iterations, err = strconv.Atoi(rounds)
+		if err != nil {
+			return Result{}, ErrInvalidHash
+		}
+
+		salt, key, err = decodeSaltAndKey(vals[3], vals[4], base64.RawStdEncoding)
+
+	} else {
+
+		iterations, err = strconv.Atoi(vals[2])
+		if err != nil {
+			return Result{}, ErrInvalidHash
+		}
+
+		// passlib uses "." instead of "+".
+		salt, key, err = decodeSaltAndKey(strings.ReplaceAll(vals[3], ".", "+"), strings.ReplaceAll(vals[4], ".", "+"), base64.RawStdEncoding)
+	}
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if iterations < 1 {
+		return Result{}, ErrInvalidHash
+	}
+
+	return verifyNormalized(plaintext, func(input string) (Result, error) {
+
+		maybe := pbkdf2.Key([]byte(input), salt, iterations, len(key), sha256.New)
+
+		return Result{
+			Match:    subtle.ConstantTimeCompare(key, maybe) == 1,
+			Outdated: iterations < p.iterations,
+		}, nil
+	})
+}
+
+func decodeSaltAndKey(salt, key string, enc *base64.Encoding) ([]byte, []byte, error) {
+
+	s, err := enc.Strict().DecodeString(salt)
+	if err != nil {
+		return nil, nil, ErrInvalidHash
+	}
+
+	k, err := enc.Strict().DecodeString(key)
+	if err != nil || len(k) == 0 {
+		return nil, nil, ErrInvalidHash
+	}
+
+	return s, k, nil
+}
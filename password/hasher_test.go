@@ -0,0 +1,164 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+
+	const plaintext = "correct horse"
+
+	bcrypted, err := Bcrypt(bcrypt.MinCost).Hash(plaintext)
+	require.NoError(t, err)
+
+	argon, err := Argon2(Iterations(1), Memory(8*1024), Parallelism(1)).Hash(plaintext)
+	require.NoError(t, err)
+
+	current, err := Argon2().Hash(plaintext)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		hash string
+		want Result
+		err  error
+	}{
+		{name: "argon2id", hash: current, want: Result{Match: true}},
+		{name: "argon2id weaker", hash: argon, want: Result{Match: true, Outdated: true}},
+		{name: "bcrypt", hash: bcrypted, want: Result{Match: true, Outdated: true}},
+		// Made with python's hashlib, in the formats used by passlib.
+		{name: "scrypt", hash: "$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$A9lBa6RTbfBovWqamVIqXKovIl4Vk6OZyVojLJmYmSI", want: Result{Match: true, Outdated: true}},
+		{name: "pbkdf2 passlib", hash: "$pbkdf2-sha256$29000$c2FsdHNhbHRzYWx0c2FsdA$wdimsZz82dUhh09vxCX.tZ6CiAyYHJSfs9wD5qYnfzg", want: Result{Match: true, Outdated: true}},
+		{name: "pbkdf2 phc", hash: "$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$BBs+1+PaslLtBPULUr8/lQicvVuHiEPMz0i8MjLCbzM", want: Result{Match: true, Outdated: true}},
+		{name: "unknown", hash: "$md5$abc", err: ErrUnknownAlgorithm},
+		{name: "plain text", hash: plaintext, err: ErrUnknownAlgorithm},
+		{name: "broken scrypt", hash: "$scrypt$ln=10$abc", err: ErrInvalidHash},
+		{name: "broken pbkdf2", hash: "$pbkdf2-sha256$many$c2FsdA$c2FsdA", err: ErrInvalidHash},
+		{name: "broken bcrypt", hash: "$2a$xx", err: ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			result, err := Verify(plaintext, tt.hash)
+			check.ErrorIs(err, tt.err)
+			check.Equal(tt.want, result)
+
+			if tt.err != nil {
+				return
+			}
+
+			result, err = Verify("wrong", tt.hash)
+			check.NoError(err)
+			check.False(result.Match)
+
+		})
+	}
+
+}
+
+func TestRegistry(t *testing.T) {
+
+	check := require.New(t)
+
+	hashers := []Hasher{Argon2(), Bcrypt(bcrypt.MinCost), Scrypt(10, 8, 1), PBKDF2SHA256(1000)}
+
+	for x, current := range hashers {
+
+		registry := NewRegistry(current, hashers...)
+
+		hash, err := registry.Hash("plaintext")
+		check.NoError(err)
+		check.True(hashers[x].Identify(hash))
+
+		result, err := registry.Verify("plaintext", hash)
+		check.NoError(err)
+		check.Equal(Result{Match: true}, result)
+
+		// Stronger parameters make the hash outdated.
+		stronger := []Hasher{Argon2(Iterations(2)), Bcrypt(bcrypt.MinCost + 1), Scrypt(11, 8, 1), PBKDF2SHA256(1001)}[x]
+
+		result, err = NewRegistry(stronger).Verify("plaintext", hash)
+		check.NoError(err)
+		check.Equal(Result{Match: true, Outdated: true}, result)
+	}
+
+	_, err := Scrypt(0, 8, 1).Hash("plaintext")
+	check.ErrorIs(err, ErrInvalidParameters)
+
+	_, err = PBKDF2SHA256(0).Hash("plaintext")
+	check.ErrorIs(err, ErrInvalidParameters)
+
+	// Check accepts legacy hashes.
+	ok, err := Check("correct horse", "$pbkdf2-sha256$29000$c2FsdHNhbHRzYWx0c2FsdA$wdimsZz82dUhh09vxCX.tZ6CiAyYHJSfs9wD5qYnfzg")
+	check.NoError(err)
+	check.True(ok)
+
+	// Parsed hashes keep their variant.
+	p, err := Create("plaintext")
+	check.NoError(err)
+
+	parsed, err := Parse(p.String())
+	check.NoError(err)
+	check.Equal(p.String(), parsed.String())
+
+}
+
+func TestNormalizedHashing(t *testing.T) {
+
+	// The ligature and the full width digit are "fi1" in NFKC.
+	const (
+		decomposed = "ﬁ１ horse battery"
+		normalized = "fi1 horse battery"
+	)
+
+	hashers := map[string]Hasher{
+		"argon2": Argon2(Iterations(1), Memory(8*1024), Parallelism(1)),
+		"bcrypt": Bcrypt(bcrypt.MinCost),
+		"scrypt": Scrypt(10, 8, 1),
+		"pbkdf2": PBKDF2SHA256(1000),
+	}
+
+	for name, h := range hashers {
+		t.Run(name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			hash, err := h.Hash(decomposed)
+			check.NoError(err)
+
+			for _, plaintext := range []string{decomposed, normalized} {
+				result, err := h.Verify(plaintext, hash)
+				check.NoError(err)
+				check.Equal(Result{Match: true}, result, plaintext)
+			}
+		})
+	}
+
+	check := require.New(t)
+
+	// Hashes of the plaintext as it was typed still match, and are upgraded.
+	legacy, err := bcrypt.GenerateFromPassword([]byte(decomposed), bcrypt.MinCost)
+	check.NoError(err)
+
+	result, err := Bcrypt(bcrypt.MinCost).Verify(decomposed, string(legacy))
+	check.NoError(err)
+	check.Equal(Result{Match: true, Outdated: true}, result)
+
+	result, err = Bcrypt(bcrypt.MinCost).Verify("wrong", string(legacy))
+	check.NoError(err)
+	check.False(result.Match)
+
+	// Create and Compare normalize too.
+	p, err := Create(decomposed, Iterations(1), Memory(8*1024), Parallelism(1))
+	check.NoError(err)
+
+	match, err := Compare(normalized, *p)
+	check.NoError(err)
+	check.True(match)
+}
@@ -15,6 +15,8 @@ var (
 	ErrInvalidHash         = errors.New("invalid hash")
 	ErrIncompatibleVariant = errors.New("incompatible variant")
 	ErrIncompatibleVersion = errors.New("incompatible version")
+	ErrEmptyPassword       = errors.New("password is empty")
+	ErrInvalidKeyLength    = errors.New("key length must be at least 16 bytes")
 )
 
 const Variant = "argon2id"
@@ -25,6 +27,7 @@ type config struct {
 	parallelism uint8
 	saltLength  int
 	keyLength   uint32
+	peppers     []pepper
 }
 
 type Option interface {
@@ -69,8 +72,16 @@ func SaltLength(length int) Option {
 	})
 }
 
+// KeyLength sets the length of the derived key in bytes, the default is 32 and the least is 16.
 func KeyLength(length uint32) Option {
 	return option(func(c *config) error {
+
+		if length < 16 {
+			return ErrInvalidKeyLength
+		}
+
+		c.keyLength = length
+
 		return nil
 	})
 }
@@ -83,6 +94,7 @@ type Password struct {
 	Parallelism uint8
 	Salt        []byte
 	Key         []byte
+	PepperID    string // Empty when no pepper was used.
 }
 
 func (p Password) String() string {
@@ -90,11 +102,15 @@ func (p Password) String() string {
 	b64Salt := base64.RawStdEncoding.EncodeToString(p.Salt)
 	b64Key := base64.RawStdEncoding.EncodeToString(p.Key)
 
-	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", p.Variant, p.Version, p.Memory, p.Iterations, p.Parallelism, b64Salt, b64Key)
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+	if p.PepperID != "" {
+		params += ",k=" + p.PepperID
+	}
+
+	return fmt.Sprintf("$%s$v=%d$%s$%s$%s", p.Variant, p.Version, params, b64Salt, b64Key)
 }
 
-// Create a password.
-func Create(pwd string, opts ...Option) (*Password, error) {
+func newConfig(opts ...Option) (config, error) {
 
 	var (
 		err error
@@ -111,6 +127,17 @@ func Create(pwd string, opts ...Option) (*Password, error) {
 		err = errors.Join(err, opt.apply(&c))
 	}
 
+	return c, err
+}
+
+// Create a password from the NFKC form of pwd. Empty passwords are rejected, use Policy to check anything else.
+func Create(pwd string, opts ...Option) (*Password, error) {
+
+	if pwd == "" {
+		return nil, ErrEmptyPassword
+	}
+
+	c, err := newConfig(opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -128,27 +155,67 @@ func Create(pwd string, opts ...Option) (*Password, error) {
 		return nil, err
 	}
 
-	p.Key = argon2.IDKey([]byte(pwd), p.Salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(p.Salt)))
+	input := []byte(Normalize(pwd))
+
+	if len(c.peppers) > 0 {
+		p.PepperID = c.peppers[0].id
+		input = c.peppers[0].mix(input)
+	}
+
+	p.Key = argon2.IDKey(input, p.Salt, p.Iterations, p.Memory, p.Parallelism, c.keyLength)
 
 	return p, nil
 }
 
-// Check that the plaintext and hashed string match.
+// Check that the plaintext and hashed string match. Any algorithm known by Default is accepted.
 func Check(plaintext, hashed string) (bool, error) {
 
-	pwd, err := Parse(hashed)
+	result, err := Verify(plaintext, hashed)
 	if err != nil {
 		return false, err
 	}
 
-	return Compare(plaintext, *pwd)
+	return result.Match, nil
 
 }
 
 // Compare a plaintext string and the Password type. Return their results or any errors.
-func Compare(plaintext string, pwd Password) (bool, error) {
+// A password created with a pepper needs the Pepper with the same id in opts.
+func Compare(plaintext string, pwd Password, opts ...Option) (bool, error) {
+
+	result, err := verifyNormalized(plaintext, func(input string) (Result, error) {
+		match, err := compareKey(input, pwd, opts...)
+		return Result{Match: match}, err
+	})
 
-	maybe := argon2.IDKey([]byte(plaintext), pwd.Salt, pwd.Iterations, pwd.Memory, pwd.Parallelism, uint32(len(pwd.Salt)))
+	return result.Match, err
+}
+
+// compareKey compares the input as it is with the key of the password.
+func compareKey(plaintext string, pwd Password, opts ...Option) (bool, error) {
+
+	input := []byte(plaintext)
+
+	if pwd.PepperID != "" {
+
+		c, err := newConfig(opts...)
+		if err != nil {
+			return false, err
+		}
+
+		found, ok := c.pepper(pwd.PepperID)
+		if !ok {
+			return false, ErrUnknownPepper
+		}
+
+		input = found.mix(input)
+	}
+
+	if len(pwd.Key) == 0 {
+		return false, ErrInvalidHash
+	}
+
+	maybe := argon2.IDKey(input, pwd.Salt, pwd.Iterations, pwd.Memory, pwd.Parallelism, uint32(len(pwd.Key)))
 
 	if subtle.ConstantTimeCompare(pwd.Key, maybe) == 1 {
 		return true, nil
@@ -190,11 +257,20 @@ func Parse(hash string) (*Password, error) {
 		return nil, ErrIncompatibleVersion
 	}
 
-	params := &Password{}
+	params := &Password{Variant: Variant, Version: version}
 	if _, err := fmt.Sscanf(vals[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
 		return nil, err
 	}
 
+	if _, id, ok := strings.Cut(vals[3], ",k="); ok {
+
+		if !validPepperID(id) {
+			return nil, ErrInvalidHash
+		}
+
+		params.PepperID = id
+	}
+
 	params.Salt, err = base64.RawStdEncoding.Strict().DecodeString(vals[4])
 	if err != nil {
 		return nil, err
@@ -2,6 +2,7 @@ package password
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -40,3 +41,52 @@ func TestPassword(t *testing.T) {
 	check.True(ok)
 
 }
+
+func TestKeyLength(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := Create("plaintext", KeyLength(8))
+	check.ErrorIs(err, ErrInvalidKeyLength)
+
+	for _, length := range []uint32{16, 32, 64} {
+
+		p, err := Create("plaintext", KeyLength(length), SaltLength(16))
+		check.NoError(err)
+		check.Len(p.Key, int(length))
+		check.Len(p.Salt, 16)
+
+		ok, err := Check("plaintext", p.String())
+		check.NoError(err)
+		check.True(ok)
+	}
+
+	// Shorter keys than the current length are outdated.
+	short, err := Argon2(KeyLength(16)).Hash("plaintext")
+	check.NoError(err)
+
+	result, err := Verify("plaintext", short)
+	check.NoError(err)
+	check.Equal(Result{Match: true, Outdated: true}, result)
+
+}
+
+func TestCalibrate(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := Calibrate(0)
+	check.ErrorIs(err, ErrInvalidTarget)
+
+	found, err := Calibrate(5*time.Millisecond, MemoryInMB(1), Parallelism(1))
+	check.NoError(err)
+	check.Equal(uint32(1024), found.Memory)
+	check.Equal(uint8(1), found.Parallelism)
+	check.GreaterOrEqual(found.Iterations, uint32(1))
+	check.Positive(found.Took)
+
+	p, err := Create("plaintext", found.Options()...)
+	check.NoError(err)
+	check.Equal(found.Iterations, p.Iterations)
+
+}
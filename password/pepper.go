@@ -0,0 +1,79 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+var (
+	ErrInvalidPepper = errors.New("pepper needs an alphanumeric id and a secret of at least 32 bytes")
+	ErrUnknownPepper = errors.New("hash was made with an unknown pepper")
+)
+
+// pepper is a server side secret mixed into the password before it is hashed.
+type pepper struct {
+	id     string
+	secret []byte
+}
+
+// mix returns the HMAC-SHA256 of the plaintext keyed by the pepper.
+func (p pepper) mix(plaintext []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	_, _ = mac.Write(plaintext)
+	return mac.Sum(nil)
+}
+
+// Pepper mixes a server side secret into passwords with HMAC-SHA256 before they are hashed.
+// The id is kept in the hash as "k=id", so it can be given more than once to rotate peppers:
+// the first one is used by Create, and all of them by Compare.
+// The secret must be kept outside of the database, losing it makes every hash that used it useless.
+// Peppered hashes are only verified by a Registry with the pepper, Default, Check and Verify return ErrUnknownPepper.
+func Pepper(id string, secret []byte) Option {
+	return option(func(c *config) error {
+
+		if !validPepperID(id) || len(secret) < 32 {
+			return ErrInvalidPepper
+		}
+
+		c.peppers = append(c.peppers, pepper{id: id, secret: secret})
+
+		return nil
+	})
+}
+
+func (c config) pepper(id string) (pepper, bool) {
+
+	for _, p := range c.peppers {
+		if p.id == id {
+			return p, true
+		}
+	}
+
+	return pepper{}, false
+}
+
+// currentPepper returns the id of the pepper used by Create.
+func (c config) currentPepper() string {
+
+	if len(c.peppers) == 0 {
+		return ""
+	}
+
+	return c.peppers[0].id
+}
+
+func validPepperID(id string) bool {
+
+	if id == "" || len(id) > 32 {
+		return false
+	}
+
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
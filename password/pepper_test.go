@@ -0,0 +1,71 @@
+package password
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPepper(t *testing.T) {
+
+	check := require.New(t)
+
+	first := bytes.Repeat([]byte("a"), 32)
+	second := bytes.Repeat([]byte("b"), 32)
+
+	_, err := Create("plaintext", Pepper("has,comma", first))
+	check.ErrorIs(err, ErrInvalidPepper)
+
+	_, err = Create("plaintext", Pepper("one", []byte("short")))
+	check.ErrorIs(err, ErrInvalidPepper)
+
+	p, err := Create("plaintext", Pepper("one", first))
+	check.NoError(err)
+	check.Equal("one", p.PepperID)
+	check.Contains(p.String(), ",k=one$")
+
+	parsed, err := Parse(p.String())
+	check.NoError(err)
+	check.Equal("one", parsed.PepperID)
+
+	ok, err := Compare("plaintext", *parsed, Pepper("one", first))
+	check.NoError(err)
+	check.True(ok)
+
+	// The pepper is part of the hash.
+	ok, err = Compare("plaintext", *parsed, Pepper("one", second))
+	check.NoError(err)
+	check.False(ok)
+
+	_, err = Compare("plaintext", *parsed)
+	check.ErrorIs(err, ErrUnknownPepper)
+
+	// Rotating keeps old hashes working, and marks them outdated.
+	rotated := Argon2(Pepper("two", second), Pepper("one", first))
+
+	result, err := rotated.Verify("plaintext", p.String())
+	check.NoError(err)
+	check.Equal(Result{Match: true, Outdated: true}, result)
+
+	hash, err := rotated.Hash("plaintext")
+	check.NoError(err)
+	check.True(strings.Contains(hash, ",k=two$"))
+
+	result, err = rotated.Verify("plaintext", hash)
+	check.NoError(err)
+	check.Equal(Result{Match: true}, result)
+
+	// Hashes without a pepper are outdated once one is configured.
+	plain, err := Argon2().Hash("plaintext")
+	check.NoError(err)
+
+	result, err = rotated.Verify("plaintext", plain)
+	check.NoError(err)
+	check.Equal(Result{Match: true, Outdated: true}, result)
+
+	_, err = Parse("$argon2id$v=19$m=65536,t=1,p=2,k=not-valid$c2FsdA$c2FsdA")
+	check.ErrorIs(err, ErrInvalidHash)
+
+}
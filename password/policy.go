@@ -0,0 +1,306 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrInvalidLength = errors.New("invalid password length")
+	ErrNilFS         = errors.New("file system is nil")
+)
+
+// Code identifies why a password was rejected, so that the reason can be translated.
+type Code string
+
+const (
+	CodeTooShort Code = "too_short"
+	CodeTooLong  Code = "too_long"
+	CodeBanned   Code = "banned"
+	CodeSimilar  Code = "similar"
+	CodeBreached Code = "breached"
+)
+
+// Violation is one reason a password was rejected. Limit is the length for CodeTooShort and CodeTooLong,
+// and how many times the password was seen for CodeBreached.
+type Violation struct {
+	Code  Code
+	Limit int
+}
+
+func (v Violation) Error() string {
+
+	switch v.Code {
+	case CodeTooShort:
+		return fmt.Sprintf("password must be at least %d characters", v.Limit)
+	case CodeTooLong:
+		return fmt.Sprintf("password must be at most %d characters", v.Limit)
+	case CodeBanned:
+		return "password contains a banned word"
+	case CodeSimilar:
+		return "password is too similar to the account"
+	case CodeBreached:
+		return "password has appeared in a data breach"
+	}
+
+	return string(v.Code)
+}
+
+// Violations is the error returned by Policy.Validate when the password is rejected.
+type Violations []Violation
+
+func (v Violations) Error() string {
+
+	msgs := make([]string, len(v))
+
+	for x, single := range v {
+		msgs[x] = single.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Has reports if the code is one of the violations.
+func (v Violations) Has(code Code) bool {
+
+	for _, single := range v {
+		if single.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+type PolicyOption interface {
+	apply(*Policy) error
+}
+
+type policyOption func(*Policy) error
+
+func (o policyOption) apply(p *Policy) error {
+	return o(p)
+}
+
+// MinLength sets the least amount of characters, the default is 8.
+func MinLength(length int) PolicyOption {
+	return policyOption(func(p *Policy) error {
+
+		if length < 1 {
+			return ErrInvalidLength
+		}
+
+		p.min = length
+
+		return nil
+	})
+}
+
+// MaxLength sets the most amount of characters, the default is 64.
+func MaxLength(length int) PolicyOption {
+	return policyOption(func(p *Policy) error {
+
+		if length < 1 {
+			return ErrInvalidLength
+		}
+
+		p.max = length
+
+		return nil
+	})
+}
+
+// BannedWords rejects passwords that contain any of the words, ignoring case.
+func BannedWords(words ...string) PolicyOption {
+	return policyOption(func(p *Policy) error {
+
+		for _, word := range words {
+			if word = fold(word); word != "" {
+				p.banned = append(p.banned, word)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Breaches rejects passwords found in a local copy of the Have I Been Pwned passwords.
+// fsys holds one file per SHA-1 prefix, named after the five upper case hex characters with or without ".txt",
+// each with "SUFFIX:COUNT" lines as returned by the range API. Only the file of the prefix is read.
+func Breaches(fsys fs.FS) PolicyOption {
+	return policyOption(func(p *Policy) error {
+
+		if fsys == nil {
+			return ErrNilFS
+		}
+
+		p.breaches = fsys
+
+		return nil
+	})
+}
+
+// Policy validates passwords before they are hashed, following NIST SP 800-63B.
+type Policy struct {
+	min      int
+	max      int
+	banned   []string
+	breaches fs.FS
+}
+
+// NewPolicy returns a Policy, by default passwords have between 8 and 64 characters.
+func NewPolicy(opts ...PolicyOption) (*Policy, error) {
+
+	var (
+		err error
+		p   = &Policy{min: 8, max: 64}
+	)
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(p))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.min > p.max {
+		return nil, ErrInvalidLength
+	}
+
+	return p, nil
+}
+
+// Normalize returns the NFKC form of the password, which is what Policy measures and what the hashers hash.
+func Normalize(plaintext string) string {
+	return norm.NFKC.String(plaintext)
+}
+
+// Validate checks the password against the policy. related are the things the password should not resemble,
+// like the email and name of the user. A rejected password returns Violations, other errors come from reading the breaches.
+func (p *Policy) Validate(plaintext string, related ...string) error {
+
+	var (
+		found      Violations
+		normalized = Normalize(plaintext)
+		length     = utf8.RuneCountInString(normalized)
+		folded     = fold(normalized)
+	)
+
+	if length < p.min {
+		found = append(found, Violation{Code: CodeTooShort, Limit: p.min})
+	}
+
+	if length > p.max {
+		found = append(found, Violation{Code: CodeTooLong, Limit: p.max})
+	}
+
+	for _, word := range p.banned {
+		if strings.Contains(folded, word) {
+			found = append(found, Violation{Code: CodeBanned})
+			break
+		}
+	}
+
+	if similar(folded, related) {
+		found = append(found, Violation{Code: CodeSimilar})
+	}
+
+	if p.breaches != nil && normalized != "" {
+
+		count, err := p.breached(normalized)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			found = append(found, Violation{Code: CodeBreached, Limit: count})
+		}
+	}
+
+	if len(found) > 0 {
+		return found
+	}
+
+	return nil
+}
+
+// breached returns how many times the password was seen, reading only the file for its hash prefix.
+func (p *Policy) breached(plaintext string) (int, error) {
+
+	sum := sha1.Sum([]byte(plaintext))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := p.breaches.Open(prefix + ".txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = p.breaches.Open(prefix)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+
+		found, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(found, suffix) {
+			continue
+		}
+
+		// Padding lines have a count of zero.
+		return strconv.Atoi(count)
+	}
+
+	return 0, scanner.Err()
+}
+
+// similar reports if the password contains, or is contained in, any part of the related values of at least 4 characters.
+func similar(folded string, related []string) bool {
+
+	for _, value := range related {
+
+		value = fold(Normalize(value))
+		if value == "" {
+			continue
+		}
+
+		if strings.Contains(value, folded) && utf8.RuneCountInString(folded) >= 4 {
+			return true
+		}
+
+		parts := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+
+		for _, part := range parts {
+			if utf8.RuneCountInString(part) >= 4 && strings.Contains(folded, part) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func fold(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
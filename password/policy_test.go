@@ -0,0 +1,103 @@
+package password
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicy(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := NewPolicy(MinLength(0))
+	check.ErrorIs(err, ErrInvalidLength)
+
+	_, err = NewPolicy(MinLength(20), MaxLength(10))
+	check.ErrorIs(err, ErrInvalidLength)
+
+	_, err = NewPolicy(Breaches(nil))
+	check.ErrorIs(err, ErrNilFS)
+
+}
+
+func TestPolicyValidate(t *testing.T) {
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	breaches := fstest.MapFS{
+		"5BAA6.txt": {Data: []byte("0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n")},
+	}
+
+	policy, err := NewPolicy(MaxLength(20), BannedWords("reverb", " "), Breaches(breaches))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		plaintext string
+		related   []string
+		want      []Code
+	}{
+		{name: "valid", plaintext: "correct horse staple", related: []string{"jane@example.com", "Jane Doe"}},
+		{name: "empty", plaintext: "", want: []Code{CodeTooShort}},
+		{name: "short", plaintext: "short", want: []Code{CodeTooShort}},
+		{name: "long", plaintext: "this password is far too long", want: []Code{CodeTooLong}},
+		// Eight runes, but more bytes.
+		{name: "unicode length", plaintext: "ñandú日本語ok"},
+		// The full width letters are normalized before the banned words are looked for.
+		{name: "banned", plaintext: "my ＲＥＶＥＲＢ pass", want: []Code{CodeBanned}},
+		{name: "similar to name", plaintext: "janedoe2024", related: []string{"jane@example.com", "Jane Doe"}, want: []Code{CodeSimilar}},
+		{name: "similar to email", plaintext: "example-pass", related: []string{"jane@example.com"}, want: []Code{CodeSimilar}},
+		{name: "contained in email", plaintext: "jane@example", related: []string{"jane@example.com"}, want: []Code{CodeSimilar}},
+		{name: "breached", plaintext: "password", want: []Code{CodeBreached}},
+		{name: "several", plaintext: "reverb", want: []Code{CodeTooShort, CodeBanned}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			err := policy.Validate(tt.plaintext, tt.related...)
+
+			if len(tt.want) == 0 {
+				check.NoError(err)
+				return
+			}
+
+			var violations Violations
+			check.True(errors.As(err, &violations))
+
+			codes := make([]Code, len(violations))
+			for x, v := range violations {
+				codes[x] = v.Code
+			}
+
+			check.Equal(tt.want, codes)
+			check.NotEmpty(err.Error())
+
+		})
+	}
+
+	err = policy.Validate("password")
+
+	var violations Violations
+	require.True(t, errors.As(err, &violations))
+	require.True(t, violations.Has(CodeBreached))
+	require.Equal(t, Violation{Code: CodeBreached, Limit: 9545824}, violations[0])
+	require.Equal(t, "password has appeared in a data breach", violations[0].Error())
+
+}
+
+func TestCreateEmpty(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := Create("")
+	check.ErrorIs(err, ErrEmptyPassword)
+
+	_, err = Hash("")
+	check.ErrorIs(err, ErrEmptyPassword)
+
+}
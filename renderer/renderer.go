@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/labstack/echo/v4"
 	"golang.org/x/exp/maps"
@@ -16,6 +17,19 @@ type Option interface {
 	apply(*config) error
 }
 
+type Options []Option
+
+func (o Options) apply(c *config) error {
+
+	var err error
+
+	for _, single := range o {
+		err = errors.Join(err, single.apply(c))
+	}
+
+	return err
+}
+
 type option func(*config) error
 
 func (o option) apply(c *config) error {
@@ -23,9 +37,10 @@ func (o option) apply(c *config) error {
 }
 
 type config struct {
-	name  string
-	files []string
-	funcs template.FuncMap
+	name     string
+	files    []string
+	funcs    template.FuncMap
+	contexts map[string]func(echo.Context) any
 }
 
 var (
@@ -44,27 +59,59 @@ func Func(title string, function any) Option {
 			return ErrEmptyFunction
 		}
 
-		if title == "" {
-			return ErrMissingTitle
+		if err := c.available(title); err != nil {
+			return err
 		}
 
-		keys := maps.Keys(c.funcs)
+		c.funcs[title] = function
+
+		return nil
 
-		for x := range keys {
-			keys[x] = strings.ToLower(keys[x])
+	})
+}
+
+// ContextFunc adds a function to use in the templates that is bound to the echo.Context being rendered.
+// In the template it takes no arguments, i.e. {{ csrfField }}. Title must be unique.
+// When rendering without a context the function is not called and renders nothing.
+func ContextFunc(title string, function func(echo.Context) any) Option {
+	return option(func(c *config) error {
+
+		if function == nil {
+			return ErrEmptyFunction
 		}
 
-		if slices.Contains(keys, strings.ToLower(title)) {
-			return ErrFunctionExists
+		if err := c.available(title); err != nil {
+			return err
 		}
 
-		c.funcs[title] = function
+		// Placeholder so the templates can be parsed, replaced in the copies that Render binds.
+		c.funcs[title] = func() any { return nil }
+		c.contexts[title] = function
 
 		return nil
 
 	})
 }
 
+func (c *config) available(title string) error {
+
+	if title == "" {
+		return ErrMissingTitle
+	}
+
+	keys := maps.Keys(c.funcs)
+
+	for x := range keys {
+		keys[x] = strings.ToLower(keys[x])
+	}
+
+	if slices.Contains(keys, strings.ToLower(title)) {
+		return ErrFunctionExists
+	}
+
+	return nil
+}
+
 // AddFiles to be used with the renderer.
 // This function removes duplicates.
 func AddFiles(files ...string) Option {
@@ -94,7 +141,8 @@ func New(files fs.FS, opts ...Option) (echo.Renderer, error) {
 	var (
 		err error
 		c   = &config{
-			funcs: make(template.FuncMap),
+			funcs:    make(template.FuncMap),
+			contexts: make(map[string]func(echo.Context) any),
 		}
 	)
 
@@ -115,13 +163,71 @@ func New(files fs.FS, opts ...Option) (echo.Renderer, error) {
 		return nil, err
 	}
 
-	return &Renderer{tmp}, nil
+	return &Renderer{templates: tmp, contexts: c.contexts}, nil
 }
 
+// Renderer executes the templates. Templates with context functions are never executed directly,
+// each render borrows a copy whose functions are bound to the context being rendered.
 type Renderer struct {
 	templates *template.Template
+	contexts  map[string]func(echo.Context) any
+	bound     sync.Pool
+}
+
+// bound is a copy of the templates whose context functions read c, it is escaped on its first render and then reused.
+type bound struct {
+	templates *template.Template
+	c         echo.Context
+}
+
+func (r *Renderer) borrow() (*bound, error) {
+
+	if b, ok := r.bound.Get().(*bound); ok {
+		return b, nil
+	}
+
+	tmp, err := r.templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bound{}
+
+	funcs := make(template.FuncMap, len(r.contexts))
+
+	for title, function := range r.contexts {
+		function := function
+		funcs[title] = func() any {
+			// Without a context, i.e. for a mail, the functions render nothing.
+			if b.c == nil {
+				return nil
+			}
+			return function(b.c)
+		}
+	}
+
+	b.templates = tmp.Funcs(funcs)
+
+	return b, nil
 }
 
 func (r *Renderer) Render(w io.Writer, name string, data any, c echo.Context) error {
-	return r.templates.ExecuteTemplate(w, name, data)
+
+	if len(r.contexts) < 1 {
+		return r.templates.ExecuteTemplate(w, name, data)
+	}
+
+	b, err := r.borrow()
+	if err != nil {
+		return err
+	}
+
+	b.c = c
+
+	defer func() {
+		b.c = nil
+		r.bound.Put(b)
+	}()
+
+	return b.templates.ExecuteTemplate(w, name, data)
 }
@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"bytes"
 	"io"
 	"io/fs"
 	"net/http"
@@ -72,6 +73,70 @@ func TestRenderer(t *testing.T) {
 
 }
 
+func TestContextFunc(t *testing.T) {
+
+	var (
+		err   error
+		check = require.New(t)
+		e     = echo.New()
+	)
+
+	f := fstest.MapFS{
+		"value.html": {Data: []byte(`<p>{{ value }}</p>`)},
+	}
+
+	e.Renderer, err = New(f, AddFiles("value.html"), ContextFunc("value", func(c echo.Context) any {
+		return c.Get("value")
+	}))
+	check.NoError(err)
+
+	for _, value := range []string{"first", "second"} {
+
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		ctx.Set("value", value)
+
+		check.NoError(ctx.Render(http.StatusOK, "value.html", nil))
+		check.Equal("<p>"+value+"</p>", rec.Body.String())
+	}
+
+}
+
+func TestContextFuncWithoutContext(t *testing.T) {
+
+	check := require.New(t)
+
+	f := fstest.MapFS{
+		"value.html": {Data: []byte(`<p>{{ value }}</p>`)},
+	}
+
+	r, err := New(f, AddFiles("value.html"), ContextFunc("value", func(c echo.Context) any {
+		return c.Get("value")
+	}))
+	check.NoError(err)
+
+	// Rendering without a context, i.e. a mail, does not break the renders that have one.
+	var buf bytes.Buffer
+
+	check.NoError(r.Render(&buf, "value.html", nil, nil))
+	check.Equal("<p></p>", buf.String())
+
+	e := echo.New()
+	e.Renderer = r
+
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	ctx.Set("value", "bound")
+
+	check.NoError(ctx.Render(http.StatusOK, "value.html", nil))
+	check.Equal("<p>bound</p>", rec.Body.String())
+
+	buf.Reset()
+
+	check.NoError(r.Render(&buf, "value.html", nil, nil))
+	check.Equal("<p></p>", buf.String())
+}
+
 func TestNew(t *testing.T) {
 	type args struct {
 		files fs.FS
@@ -168,6 +233,42 @@ func TestNew(t *testing.T) {
 			wantErr:     true,
 			specificErr: ErrFunctionExists,
 		},
+		{
+			name: "fs, filename, and context function",
+			args: args{
+				files: files(),
+				opts: []Option{
+					AddFiles(filename),
+					ContextFunc("path", func(c echo.Context) any { return c.Path() }),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "fs, filename, and context function without function",
+			args: args{
+				files: files(),
+				opts: []Option{
+					AddFiles(filename),
+					ContextFunc("path", nil),
+				},
+			},
+			wantErr:     true,
+			specificErr: ErrEmptyFunction,
+		},
+		{
+			name: "fs, filename, and context function with existing title",
+			args: args{
+				files: files(),
+				opts: []Option{
+					AddFiles(filename),
+					Func("Path", time.Now),
+					ContextFunc("path", func(c echo.Context) any { return c.Path() }),
+				},
+			},
+			wantErr:     true,
+			specificErr: ErrFunctionExists,
+		},
 		{
 			name: "adding file that doesn't exist",
 			args: args{
@@ -2,10 +2,13 @@ package reverb
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"slices"
@@ -13,11 +16,17 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/authentication"
+	"github.com/hcarriz/reverb/cors"
+	"github.com/hcarriz/reverb/csrf"
+	"github.com/hcarriz/reverb/graceful"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"golang.org/x/time/rate"
 )
 
+// Auth identifies the user behind a request.
+// On success it returns the context to continue the request with.
 type Auth interface {
 	Authenticate(echo.Context) (context.Context, bool)
 }
@@ -30,12 +39,20 @@ type pathfinder struct {
 }
 
 type config struct {
-	echo       *echo.Echo
-	logger     *slog.Logger
-	showBanner bool
-	secrets    []string
-	debug      bool
-	session    *scs.SessionManager
+	echo        *echo.Echo
+	logger      *slog.Logger
+	showBanner  bool
+	secrets     []string
+	debug       bool
+	session     *scs.SessionManager
+	partitioned bool
+	cors        *cors.Router
+	policy      string
+
+	addr            string
+	tls             *tls.Config
+	disableHTTP2    bool
+	shutdownTimeout time.Duration
 }
 
 // Errors
@@ -45,6 +62,9 @@ var (
 	ErrInvalidDuration   = errors.New("invalid duration")
 	ErrInvalidHTTPMethod = errors.New("invalid http method")
 	ErrInvalidLogger     = errors.New("invalid logger")
+	ErrMissingAuth       = errors.New("missing auth")
+	ErrMissingListener   = errors.New("missing listener")
+	ErrMissingRateLimit  = errors.New("missing rate limit")
 	ErrMissingRoutes     = errors.New("missing route")
 )
 
@@ -60,7 +80,7 @@ func (o Options) apply(a *config) error {
 	var err error
 
 	for _, single := range o {
-		err = errors.Join(single.apply(a))
+		err = errors.Join(err, single.apply(a))
 	}
 
 	return err
@@ -114,11 +134,106 @@ func WithMiddleware(middleware ...echo.MiddlewareFunc) Option {
 	})
 }
 
+// WithAuth mounts an ordered chain of Auth implementations on every route.
+// The first Auth to succeed provides the request context, requests that none accept continue unauthenticated.
+func WithAuth(list ...Auth) Option {
+	return option(func(c *config) error {
+
+		if len(list) < 1 {
+			return ErrMissingAuth
+		}
+
+		chain := make([]authentication.Authenticator, 0, len(list))
+
+		for _, single := range list {
+
+			if single == nil {
+				return ErrMissingAuth
+			}
+
+			chain = append(chain, single)
+		}
+
+		c.echo.Use(authentication.MiddlewareAuthenticators(chain...))
+
+		return nil
+	})
+}
+
+// CSRF adds cross site request forgery protection to every route, see the csrf package for the options.
+// Tokens are kept in the session unless csrf.DoubleSubmit is used.
+// Requests with a bearer token are exempt, see csrf.CheckBearer.
+func CSRF(opts ...csrf.Option) Option {
+	return option(func(c *config) error {
+
+		mw, err := csrf.New(append([]csrf.Option{csrf.SessionStore(c.session, "")}, opts...)...)
+		if err != nil {
+			return err
+		}
+
+		c.echo.Use(mw)
+
+		return nil
+	})
+}
+
 // WithRateLimit adds a rate limit middleware to the base
 func WithRateLimit(limit rate.Limit) Option {
 	return WithMiddleware(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(limit)))
 }
 
+// RateLimit is the limit of WithReloadableRateLimit, a Burst of zero is the Limit rounded down.
+type RateLimit struct {
+	Limit rate.Limit
+	Burst int
+}
+
+// WithReloadableRateLimit adds a rate limit middleware to the base that follows limits when it is reloaded:
+//
+//	limits, err := graceful.NewReloadable(ctx, loadRateLimit)
+//	reverb.New(reverb.WithReloadableRateLimit(limits))
+//	graceful.Run(ctx, services, graceful.Reload("rate limit", limits.Reload))
+//
+// When the limit changes every client starts over with a full burst.
+func WithReloadableRateLimit(limits *graceful.Reloadable[RateLimit]) Option {
+	return option(func(c *config) error {
+
+		if limits == nil {
+			return ErrMissingRateLimit
+		}
+
+		c.echo.Use(middleware.RateLimiter(&reloadableStore{limits: limits}))
+
+		return nil
+	})
+}
+
+// reloadableStore is a middleware.RateLimiterStore that replaces its limiters when the limit is reloaded.
+type reloadableStore struct {
+	limits  *graceful.Reloadable[RateLimit]
+	mu      sync.Mutex
+	current RateLimit
+	store   *middleware.RateLimiterMemoryStore
+}
+
+func (s *reloadableStore) Allow(identifier string) (bool, error) {
+
+	limit := s.limits.Load()
+
+	s.mu.Lock()
+
+	if s.store == nil || limit != s.current {
+		s.current = limit
+		s.store = middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{Rate: limit.Limit, Burst: limit.Burst})
+	}
+
+	store := s.store
+
+	s.mu.Unlock()
+
+	return store.Allow(identifier)
+}
+
 // SPA is a shorthand for Single Page Application
 func SPA(path string, files fs.FS) Option {
 	return SinglePageApplication(path, files)
@@ -164,6 +279,12 @@ func Path(method string, path string, handler echo.HandlerFunc, middleware ...ec
 			return ErrInvalidHTTPMethod
 		}
 
+		if c.policy != "" {
+			if err := c.cors.Route(path, c.policy); err != nil {
+				return err
+			}
+		}
+
 		c.echo.Add(method, path, handler, middleware...)
 
 		return nil
@@ -231,6 +352,21 @@ func Quiet() Option {
 	})
 }
 
+// Listener makes the server serve on l instead of binding its Address,
+// i.e. one from graceful.Listeners so it can be handed to the next process on restarts.
+func Listener(l net.Listener) Option {
+	return option(func(c *config) error {
+
+		if l == nil {
+			return ErrMissingListener
+		}
+
+		c.echo.Listener = l
+
+		return nil
+	})
+}
+
 func Renderer(r echo.Renderer) Option {
 	return option(func(c *config) error {
 
@@ -244,26 +380,37 @@ func Renderer(r echo.Renderer) Option {
 	})
 }
 
-func New(opts ...Option) (*echo.Echo, error) {
+// New builds the Server with the options.
+func New(opts ...Option) (*Server, error) {
 
 	// Start Echo
 	e := echo.New()
 
 	e.HideBanner = true
 
+	// Start the session manager with hardened cookies.
+	sm := scs.New()
+	sm.Cookie.HttpOnly = true
+	sm.Cookie.SameSite = http.SameSiteLaxMode
+
 	// Start the config.
 	c := config{
-		logger:  slog.Default(),
-		session: scs.New(),
-		echo:    e,
+		logger:          slog.Default(),
+		session:         sm,
+		echo:            e,
+		addr:            ":8080",
+		shutdownTimeout: 10 * time.Second,
 	}
 
+	// Load the session before any other middleware, the options only change the session manager in place.
+	c.echo.Use(c.loadAndSave())
+
 	// Prepare an error variable for use with the user provided options.
 	var err error
 
 	// Overwrite the config with the user provided options.
 	for _, opt := range opts {
-		err = errors.Join(opt.apply(&c))
+		err = errors.Join(err, opt.apply(&c))
 	}
 
 	// Check if there are any errors from the user provided options.
@@ -271,6 +418,10 @@ func New(opts ...Option) (*echo.Echo, error) {
 		return nil, err
 	}
 
+	if c.partitioned && !c.session.Cookie.Secure {
+		return nil, ErrPartitionedSession
+	}
+
 	// Use the desired logger.
 	c.echo.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogValuesFunc: func(ctx echo.Context, v middleware.RequestLoggerValues) error {
@@ -310,5 +461,5 @@ func New(opts ...Option) (*echo.Echo, error) {
 		LogResponseSize:  true,
 	}))
 
-	return c.echo, nil
+	return &Server{c: &c}, nil
 }
@@ -1,12 +1,37 @@
 package reverb
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"entgo.io/ent/dialect"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/hcarriz/reverb/authentication"
+	"github.com/hcarriz/reverb/authentication/dummy"
+	"github.com/hcarriz/reverb/cors"
+	"github.com/hcarriz/reverb/csrf"
 	"github.com/hcarriz/reverb/generated/ent"
 	"github.com/hcarriz/reverb/generated/ent/enttest"
+	"github.com/hcarriz/reverb/graceful"
+	"github.com/hcarriz/reverb/headers"
+	"github.com/hcarriz/reverb/health"
 	"github.com/hcarriz/reverb/sqlite"
+	"github.com/hcarriz/reverb/viewer"
+	"github.com/labstack/echo/v4"
+	"github.com/neilotoole/slogt"
 	"github.com/stretchr/testify/require"
 
 	_ "github.com/hcarriz/reverb/sqlite"
@@ -33,3 +58,604 @@ func TestContextEnt(t *testing.T) {
 	AddEntToContext(ent.NewContext, cl)
 
 }
+
+type headerAuth string
+
+func (h headerAuth) Authenticate(c echo.Context) (context.Context, bool) {
+
+	if id := c.Request().Header.Get(string(h)); id != "" {
+		return viewer.SetUserID(c.Request().Context(), id), true
+	}
+
+	return c.Request().Context(), false
+}
+
+func TestWithAuth(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(WithAuth())
+	check.ErrorIs(err, ErrMissingAuth)
+
+	e, err := New(Quiet(), WithAuth(headerAuth("X-First"), headerAuth("X-Second")), Path(http.MethodGet, "/", func(c echo.Context) error {
+		id, _ := viewer.GetUserID[string](c.Request().Context())
+		return c.String(http.StatusOK, id)
+	}))
+	check.NoError(err)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "none"},
+		{name: "second", headers: map[string]string{"X-Second": "two"}, want: "two"},
+		{name: "first wins", headers: map[string]string{"X-First": "one", "X-Second": "two"}, want: "one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			check.Equal(http.StatusOK, rec.Code)
+			check.Equal(tt.want, rec.Body.String())
+		})
+	}
+
+}
+
+func TestCSRF(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(CSRF(csrf.TokenLength(1)))
+	check.ErrorIs(err, csrf.ErrInvalidLength)
+
+	e, err := New(Quiet(), CSRF(), GraphQL("/graphql", false, handler.New(nil)))
+	check.NoError(err)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", nil))
+	check.Equal(http.StatusForbidden, rec.Code)
+
+	// The authentication routes authenticate after csrf, a bearer token still gets through.
+	db := &dummy.DB{}
+
+	id, err := db.CreateOrUpdateUser(context.Background(), "gothic", "faux", "user@example.com", "User")
+	check.NoError(err)
+
+	raw, err := db.GetUser(context.Background(), id)
+	check.NoError(err)
+
+	usr, ok := raw.(dummy.User)
+	check.True(ok)
+	check.NotEmpty(usr.Tokens)
+
+	e, err = New(Quiet(), CSRF(), Authentication(authentication.SetDatabase(db)))
+	check.NoError(err)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+usr.Tokens[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusSeeOther, rec.Code)
+
+	// Without the token the session has to carry a csrf token.
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/logout", nil))
+	check.Equal(http.StatusForbidden, rec.Code)
+
+}
+
+func TestSessions(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(SessionPartitioned())
+	check.ErrorIs(err, ErrPartitionedSession)
+
+	_, err = New(SessionLifetime(0))
+	check.ErrorIs(err, ErrInvalidDuration)
+
+	db := &dummy.DB{}
+
+	id, err := db.CreateOrUpdateUser(context.Background(), "gothic", "faux", "user@example.com", "User")
+	check.NoError(err)
+
+	var e *Server
+
+	e, err = New(
+		Quiet(),
+		SessionName("app"),
+		SessionSecure(),
+		SessionPartitioned(),
+		SessionPersist(true),
+		SessionLifetime(time.Hour),
+		SessionIdleTimeout(10*time.Minute),
+		CSRF(),
+		Authentication(authentication.SetDatabase(db)),
+		Path(http.MethodGet, "/", func(c echo.Context) error {
+			return c.String(http.StatusOK, csrf.Token(c))
+		}),
+		// Signs the user in the way the authentication callback does.
+		Path(http.MethodGet, "/sign-in", func(c echo.Context) error {
+
+			ctx := c.Request().Context()
+
+			e.Sessions().Put(ctx, "user_session", id)
+
+			if err := db.AddSessionToUser(ctx, "gothic", e.Sessions().Token(ctx)); err != nil {
+				return err
+			}
+
+			return c.NoContent(http.StatusNoContent)
+		}),
+	)
+	check.NoError(err)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	check.Equal(http.StatusOK, rec.Code)
+
+	token := rec.Body.String()
+	check.NotEmpty(token)
+
+	raw := rec.Header().Get(echo.HeaderSetCookie)
+	for _, attr := range []string{"app=", "HttpOnly", "Secure", "SameSite=Lax", "Partitioned", "Max-Age="} {
+		check.Contains(raw, attr)
+	}
+
+	cookies := rec.Result().Cookies()
+	check.Len(cookies, 1)
+
+	// The session is shared between requests.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(token, rec.Body.String())
+
+	// The authentication routes use the same session manager, they see what a normal route put in the session.
+	req = httptest.NewRequest(http.MethodGet, "/sign-in", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusNoContent, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/whoami", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusOK, rec.Code)
+	check.Contains(rec.Body.String(), id)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/whoami", nil))
+	check.Equal(http.StatusUnauthorized, rec.Code)
+
+}
+
+func TestSessionsWithoutBody(t *testing.T) {
+
+	check := require.New(t)
+
+	var e *Server
+
+	e, err := New(
+		Quiet(),
+		Path(http.MethodGet, "/put", func(c echo.Context) error {
+			e.Sessions().Put(c.Request().Context(), "value", "kept")
+			return nil
+		}),
+		Path(http.MethodGet, "/get", func(c echo.Context) error {
+			return c.String(http.StatusOK, e.Sessions().GetString(c.Request().Context(), "value"))
+		}),
+	)
+	check.NoError(err)
+
+	// The handler writes nothing, the session is still saved.
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/put", nil))
+
+	cookies := rec.Result().Cookies()
+	check.Len(cookies, 1)
+	check.Len(rec.Header().Values(echo.HeaderSetCookie), 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal("kept", rec.Body.String())
+}
+
+func TestCORS(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(CORS(nil))
+	check.ErrorIs(err, ErrMissingCORS)
+
+	_, err = New(CORSPolicy("spa", Path(http.MethodGet, "/", nil)))
+	check.ErrorIs(err, ErrMissingCORS)
+
+	router := cors.NewRouter()
+	check.NoError(router.Policy("public"))
+	check.NoError(router.Policy("spa", cors.Origins("https://app.example.com"), cors.Credentials()))
+	check.NoError(router.Prefix("/api/public", "public"))
+
+	_, err = New(CORS(router), CORSPolicy("missing", Path(http.MethodGet, "/", nil)))
+	check.ErrorIs(err, cors.ErrUnknownPolicy)
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+	e, err := New(
+		Quiet(),
+		CORS(router),
+		Path(http.MethodGet, "/api/public/items", ok),
+		CORSPolicy("spa", GraphQL("/graphql", false, handler.New(nil))),
+	)
+	check.NoError(err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/public/items", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://anyone.test")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal("*", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+
+	// The preflight of the GraphQL route uses its policy.
+	req = httptest.NewRequest(http.MethodOptions, "/graphql", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://app.example.com")
+	req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusNoContent, rec.Code)
+	check.Equal("https://app.example.com", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	check.Equal("true", rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+
+	req = httptest.NewRequest(http.MethodOptions, "/graphql", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://anyone.test")
+	req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Empty(rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+
+}
+
+func TestSecurityHeaders(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(SecurityHeaders(headers.ReferrerPolicy("everywhere")))
+	check.ErrorIs(err, headers.ErrInvalidValue)
+
+	_, err = New(CSPReports(""))
+	check.ErrorIs(err, ErrEmptyPath)
+
+	e, err := New(
+		Quiet(),
+		SecurityHeaders(headers.ContentSecurityPolicy(headers.NewCSP().Add(headers.DefaultSrc, headers.Self).ReportTo("/csp-reports"))),
+		CSPReports("/csp-reports"),
+		Path(http.MethodGet, "/", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}),
+	)
+	check.NoError(err)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	check.Equal("default-src 'self'; report-uri /csp-reports; report-to csp-endpoint", rec.Header().Get(echo.HeaderContentSecurityPolicy))
+	check.Equal("nosniff", rec.Header().Get(echo.HeaderXContentTypeOptions))
+
+	req := httptest.NewRequest(http.MethodPost, "/csp-reports", strings.NewReader(`{"csp-report":{"blocked-uri":"inline"}}`))
+	req.Header.Set(echo.HeaderContentType, "application/csp-report")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	check.Equal(http.StatusNoContent, rec.Code)
+
+}
+
+func TestHealth(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(Health(nil))
+	check.ErrorIs(err, ErrMissingHealth)
+
+	h, err := health.New(health.Ready("db", func(context.Context) error { return nil }))
+	check.NoError(err)
+
+	e, err := New(Quiet(), Health(h))
+	check.NoError(err)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		check.Equal(http.StatusOK, rec.Code, path)
+	}
+
+	h.Drain()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	check.Equal(http.StatusServiceUnavailable, rec.Code)
+
+}
+
+func TestListener(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(Listener(nil))
+	check.ErrorIs(err, ErrMissingListener)
+
+	l, err := graceful.Inherit()
+	check.NoError(err)
+
+	ln, err := l.Listen("tcp", "127.0.0.1:0")
+	check.NoError(err)
+
+	s, err := New(Quiet(), Listener(ln), Path(http.MethodGet, "/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}))
+	check.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go s.Start(ctx)
+
+	check.Eventually(func() bool {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+}
+
+// certificate is a self-signed certificate for 127.0.0.1.
+func certificate(t *testing.T) tls.Certificate {
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServer(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		args    []Option
+		wantErr error
+	}{
+		{name: "address", args: []Option{Address("")}, wantErr: ErrEmptyAddress},
+		{name: "tls config", args: []Option{TLSConfig(nil)}, wantErr: ErrMissingTLS},
+		{name: "tls files", args: []Option{TLS("missing.crt", "missing.key")}, wantErr: fs.ErrNotExist},
+		{name: "shutdown timeout", args: []Option{ShutdownTimeout(0)}, wantErr: ErrInvalidDuration},
+		{name: "joined", args: []Option{Address(""), ShutdownTimeout(0)}, wantErr: ErrInvalidDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.args...)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	check := require.New(t)
+
+	logger := slogt.New(t)
+	secrets := []string{"first", "second"}
+
+	s, err := New(Quiet(), Debug(), SetLogger(logger), SetSecrets(secrets...))
+	check.NoError(err)
+
+	check.True(s.Debug())
+	check.True(s.Echo().Debug)
+	check.Same(logger, s.Logger())
+	check.NotNil(s.Sessions())
+	check.Equal(secrets, s.Secrets())
+
+	s.Secrets()[0] = "changed"
+	check.Equal(secrets, s.Secrets())
+}
+
+func TestServerStart(t *testing.T) {
+
+	cert := certificate(t)
+
+	tests := []struct {
+		name  string
+		args  []Option
+		tls   bool
+		proto int
+	}{
+		{name: "http", proto: 1},
+		{name: "https", args: []Option{TLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}})}, tls: true, proto: 2},
+		{name: "http2 disabled", args: []Option{TLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}), DisableHTTP2()}, tls: true, proto: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			check.NoError(err)
+
+			s, err := New(append([]Option{Quiet(), Listener(ln), Path(http.MethodGet, "/", func(c echo.Context) error {
+				return c.String(http.StatusOK, c.Request().Proto)
+			})}, tt.args...)...)
+			check.NoError(err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			done := make(chan error, 1)
+			go func() { done <- s.Start(ctx) }()
+
+			client := &http.Client{Transport: &http.Transport{
+				ForceAttemptHTTP2: true,
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			}}
+
+			url := "http://" + ln.Addr().String()
+			if tt.tls {
+				url = "https://" + ln.Addr().String()
+			}
+
+			var resp *http.Response
+
+			check.Eventually(func() bool {
+				resp, err = client.Get(url)
+				return err == nil
+			}, time.Second, 10*time.Millisecond)
+
+			resp.Body.Close()
+
+			check.Equal(http.StatusOK, resp.StatusCode)
+			check.Equal(tt.proto, resp.ProtoMajor)
+
+			cancel()
+
+			select {
+			case err := <-done:
+				check.NoError(err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Start did not return after the context was done")
+			}
+		})
+	}
+}
+
+func TestServerService(t *testing.T) {
+
+	check := require.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	check.NoError(err)
+
+	s, err := New(Quiet(), Listener(ln))
+	check.NoError(err)
+
+	service := s.Service()
+	check.Equal("http", service.Name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- graceful.Run(ctx, []graceful.Service{service}) }()
+
+	check.Eventually(func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		check.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was done")
+	}
+}
+
+func TestReloadableRateLimit(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := New(WithReloadableRateLimit(nil))
+	check.ErrorIs(err, ErrMissingRateLimit)
+
+	var (
+		mu      sync.Mutex
+		current = RateLimit{Limit: 0.001, Burst: 1}
+	)
+
+	limits, err := graceful.NewReloadable(context.Background(), func(context.Context) (RateLimit, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return current, nil
+	})
+	check.NoError(err)
+
+	e, err := New(Quiet(), WithReloadableRateLimit(limits), Path(http.MethodGet, "/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}))
+	check.NoError(err)
+
+	allowed := func() int {
+
+		count := 0
+
+		for x := 0; x < 5; x++ {
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code == http.StatusNoContent {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	check.Equal(1, allowed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		done <- graceful.Run(ctx, []graceful.Service{{
+			Start: func() error { <-stop; return nil },
+			Close: func(context.Context) error { close(stop); return nil },
+		}}, graceful.Reload("rate limit", limits.Reload))
+	}()
+
+	// Wait for Run to be listening for the signal.
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	current = RateLimit{Limit: 0.001, Burst: 3}
+	mu.Unlock()
+
+	check.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+
+	check.Eventually(func() bool {
+		return limits.Load().Burst == 3
+	}, time.Second, 10*time.Millisecond)
+
+	check.Equal(3, allowed())
+
+	cancel()
+	check.NoError(<-done)
+}
@@ -0,0 +1,203 @@
+package reverb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/graceful"
+	"github.com/labstack/echo/v4"
+)
+
+// Errors
+var (
+	ErrEmptyAddress = errors.New("empty address")
+	ErrMissingTLS   = errors.New("missing tls config")
+)
+
+// Address sets where Start listens, the default is ":8080". It is ignored when Listener is used.
+func Address(addr string) Option {
+	return option(func(c *config) error {
+
+		if addr == "" {
+			return ErrEmptyAddress
+		}
+
+		c.addr = addr
+
+		return nil
+	})
+}
+
+// TLS serves HTTPS with the certificate and key in PEM files, with TLS 1.2 at least.
+func TLS(certFile, keyFile string) Option {
+	return option(func(c *config) error {
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+
+		c.tls = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+
+		return nil
+	})
+}
+
+// TLSConfig serves HTTPS with cfg, i.e. with graceful.GetCertificate to reload the certificate without a restart.
+func TLSConfig(cfg *tls.Config) Option {
+	return option(func(c *config) error {
+
+		if cfg == nil {
+			return ErrMissingTLS
+		}
+
+		c.tls = cfg.Clone()
+
+		return nil
+	})
+}
+
+// DisableHTTP2 only serves HTTP/1.1 over TLS. HTTP/2 is negotiated by default.
+func DisableHTTP2() Option {
+	return option(func(c *config) error {
+		c.disableHTTP2 = true
+		return nil
+	})
+}
+
+// ShutdownTimeout bounds the shutdown that Start does when its context is done, the default is 10 seconds.
+func ShutdownTimeout(duration time.Duration) Option {
+	return option(func(c *config) error {
+
+		if duration <= 0 {
+			return ErrInvalidDuration
+		}
+
+		c.shutdownTimeout = duration
+
+		return nil
+	})
+}
+
+// Debug turns on the debug mode of Echo, which shows the error details in the responses.
+func Debug() Option {
+	return option(func(c *config) error {
+		c.debug = true
+		c.echo.Debug = true
+		return nil
+	})
+}
+
+// Server is the echo server built by New, along with what the options configured for it.
+type Server struct {
+	c *config
+}
+
+// Echo returns the underlying echo instance, i.e. to add routes that reverb has no option for.
+func (s *Server) Echo() *echo.Echo {
+	return s.c.echo
+}
+
+// Sessions returns the session manager shared by the routes, the authentication and csrf.
+func (s *Server) Sessions() *scs.SessionManager {
+	return s.c.session
+}
+
+// Logger returns the logger given to SetLogger, or slog.Default.
+func (s *Server) Logger() *slog.Logger {
+	return s.c.logger
+}
+
+// Secrets returns the secrets given to SetSecrets.
+func (s *Server) Secrets() []string {
+	return slices.Clone(s.c.secrets)
+}
+
+// Debug reports if the Debug option was used.
+func (s *Server) Debug() bool {
+	return s.c.debug
+}
+
+// ServeHTTP serves the request with echo, so the Server can be used as an http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.c.echo.ServeHTTP(w, r)
+}
+
+// Start serves until ctx is done, then shuts down within the ShutdownTimeout. A clean shutdown returns nil.
+func (s *Server) Start(ctx context.Context) error {
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- s.serve()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.c.shutdownTimeout)
+	defer cancel()
+
+	return errors.Join(s.Shutdown(shutdown), <-errs)
+}
+
+// Shutdown stops accepting connections and waits for the active ones to finish, or for ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.c.echo.Shutdown(ctx)
+}
+
+// Service returns the server as a graceful.Service named "http".
+func (s *Server) Service() graceful.Service {
+	return graceful.Service{
+		Name:  "http",
+		Start: s.serve,
+		Close: s.Shutdown,
+	}
+}
+
+// serve blocks until the server is shut down.
+func (s *Server) serve() error {
+
+	e := s.c.echo
+	e.Server.Addr = s.c.addr
+
+	if s.c.tls != nil {
+
+		cfg := s.c.tls.Clone()
+
+		if s.c.disableHTTP2 {
+			cfg.NextProtos = []string{"http/1.1"}
+			e.Server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		} else if !slices.Contains(cfg.NextProtos, "h2") {
+			cfg.NextProtos = append([]string{"h2"}, cfg.NextProtos...)
+			if !slices.Contains(cfg.NextProtos, "http/1.1") {
+				cfg.NextProtos = append(cfg.NextProtos, "http/1.1")
+			}
+		}
+
+		e.Server.TLSConfig = cfg
+
+		// A listener given with the Listener option still gets TLS.
+		if e.Listener != nil && e.TLSListener == nil {
+			e.TLSListener = tls.NewListener(e.Listener, cfg)
+		}
+	}
+
+	if err := e.StartServer(e.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
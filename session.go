@@ -0,0 +1,236 @@
+package reverb
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/authentication"
+	"github.com/labstack/echo/v4"
+)
+
+// Errors
+var (
+	ErrEmptySessionName   = errors.New("session name is empty")
+	ErrEmptySessionStore  = errors.New("session store is nil")
+	ErrPartitionedSession = errors.New("partitioned session cookies must be secure")
+)
+
+// SessionName sets the name of the session cookie.
+func SessionName(name string) Option {
+	return option(func(c *config) error {
+
+		if name == "" {
+			return ErrEmptySessionName
+		}
+
+		c.session.Cookie.Name = name
+
+		return nil
+	})
+}
+
+// SessionDomain sets the domain of the session cookie.
+func SessionDomain(domain string) Option {
+	return option(func(c *config) error {
+		c.session.Cookie.Domain = domain
+		return nil
+	})
+}
+
+// SessionPath sets the path of the session cookie.
+func SessionPath(path string) Option {
+	return option(func(c *config) error {
+
+		if path == "" {
+			return ErrEmptyPath
+		}
+
+		c.session.Cookie.Path = path
+
+		return nil
+	})
+}
+
+// SessionSameSite sets the SameSite attribute of the session cookie. The default is http.SameSiteLaxMode.
+func SessionSameSite(mode http.SameSite) Option {
+	return option(func(c *config) error {
+		c.session.Cookie.SameSite = mode
+		return nil
+	})
+}
+
+// SessionSecure only sends the session cookie over HTTPS.
+func SessionSecure() Option {
+	return option(func(c *config) error {
+		c.session.Cookie.Secure = true
+		return nil
+	})
+}
+
+// SessionPartitioned adds the Partitioned attribute (CHIPS) to the session cookie. It requires SessionSecure.
+func SessionPartitioned() Option {
+	return option(func(c *config) error {
+		c.partitioned = true
+		return nil
+	})
+}
+
+// SessionIdleTimeout expires sessions that have not been used for the duration. Zero disables it.
+func SessionIdleTimeout(duration time.Duration) Option {
+	return option(func(c *config) error {
+
+		if duration < 0 {
+			return ErrInvalidDuration
+		}
+
+		c.session.IdleTimeout = duration
+
+		return nil
+	})
+}
+
+// SessionLifetime sets the absolute lifetime of a session, regardless of activity.
+func SessionLifetime(duration time.Duration) Option {
+	return option(func(c *config) error {
+
+		if duration <= 0 {
+			return ErrInvalidDuration
+		}
+
+		c.session.Lifetime = duration
+
+		return nil
+	})
+}
+
+// SessionPersist sets if the session cookie outlives the browser session.
+func SessionPersist(persist bool) Option {
+	return option(func(c *config) error {
+		c.session.Cookie.Persist = persist
+		return nil
+	})
+}
+
+// SessionStore sets where the session data is kept, i.e. a *sessions.Store.
+func SessionStore(store scs.Store) Option {
+	return option(func(c *config) error {
+
+		if store == nil {
+			return ErrEmptySessionStore
+		}
+
+		c.session.Store = store
+
+		return nil
+	})
+}
+
+// Authentication adds the routes of the authentication package, sharing the session manager of reverb.
+func Authentication(opts ...authentication.Option) Option {
+	return option(func(c *config) error {
+		return authentication.New(c.echo, append([]authentication.Option{authentication.SetSessions(c.session)}, opts...)...)
+	})
+}
+
+// loadAndSave loads the session for every request and writes the cookie when the session changes,
+// before the response is written, or after the handler when it wrote nothing, as scs.LoadAndSave does.
+func (c *config) loadAndSave() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+
+			var token string
+
+			if cookie, err := ctx.Cookie(c.session.Cookie.Name); err == nil {
+				token = cookie.Value
+			}
+
+			loaded, err := c.session.Load(ctx.Request().Context(), token)
+			if err != nil {
+				return err
+			}
+
+			ctx.SetRequest(ctx.Request().WithContext(loaded))
+
+			saved := false
+
+			save := func() {
+
+				if saved {
+					return
+				}
+
+				saved = true
+
+				cookie := &http.Cookie{
+					Name:     c.session.Cookie.Name,
+					Path:     c.session.Cookie.Path,
+					Domain:   c.session.Cookie.Domain,
+					Secure:   c.session.Cookie.Secure,
+					HttpOnly: c.session.Cookie.HttpOnly,
+					SameSite: c.session.Cookie.SameSite,
+				}
+
+				switch c.session.Status(loaded) {
+				case scs.Modified:
+
+					token, expiry, err := c.session.Commit(loaded)
+					if err != nil {
+						c.logger.LogAttrs(loaded, slog.LevelError, "unable to commit session", slog.String("error", err.Error()))
+						return
+					}
+
+					cookie.Value = token
+
+					if c.session.Cookie.Persist {
+						cookie.Expires = time.Unix(expiry.Unix()+1, 0)
+						cookie.MaxAge = int(time.Until(expiry).Seconds() + 1)
+					}
+
+				case scs.Destroyed:
+					cookie.Expires = time.Unix(1, 0)
+					cookie.MaxAge = -1
+
+				default:
+					return
+				}
+
+				value := cookie.String()
+
+				if c.partitioned {
+					value += "; Partitioned"
+				}
+
+				ctx.Response().Header().Add(echo.HeaderSetCookie, value)
+				addHeaderIfMissing(ctx.Response(), echo.HeaderCacheControl, `no-cache="Set-Cookie"`)
+				addHeaderIfMissing(ctx.Response(), echo.HeaderVary, echo.HeaderCookie)
+			}
+
+			ctx.Response().Before(save)
+
+			// Errors are written by the error handler, which saves through Before.
+			if err := next(ctx); err != nil {
+				return err
+			}
+
+			if !ctx.Response().Committed {
+				save()
+			}
+
+			return nil
+		}
+	}
+}
+
+func addHeaderIfMissing(w http.ResponseWriter, key, value string) {
+
+	for _, h := range w.Header()[key] {
+		if h == value {
+			return
+		}
+	}
+
+	w.Header().Add(key, value)
+}
@@ -1,18 +1,66 @@
 package sessions
 
 import (
+	"container/list"
 	"context"
-	"errors"
-	"maps"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func NewDB() *DB {
-	return &DB{make(map[string]entry)}
+const defaultShards = 16
+
+// DBOption configures NewDB.
+type DBOption func(*DB)
+
+// Shards sets the amount of independently locked shards. Values below 1 are ignored.
+func Shards(amount int) DBOption {
+	return func(db *DB) {
+		if amount > 0 {
+			db.shards = make([]*shard, amount)
+		}
+	}
+}
+
+// MaxEntries caps the amount of sessions kept, evicting the least recently used ones across all shards
+// once the store holds more than max. Values below 1 mean there is no cap.
+func MaxEntries(max int) DBOption {
+	return func(db *DB) {
+		if max > 0 {
+			db.max = max
+		}
+	}
+}
+
+// NewDB returns an in memory Connection that is safe for concurrent use.
+func NewDB(opts ...DBOption) *DB {
+
+	db := &DB{
+		shards: make([]*shard, defaultShards),
+	}
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	for x := range db.shards {
+		db.shards[x] = &shard{
+			entries: make(map[string]*list.Element),
+			order:   list.New(),
+		}
+	}
+
+	return db
 }
 
 type DB struct {
-	entries map[string]entry
+	shards []*shard
+	max    int
+
+	// count is the amount of sessions kept in every shard, clock orders their use across the shards.
+	count atomic.Int64
+	clock atomic.Uint64
 }
 
 type entry struct {
@@ -20,52 +68,189 @@ type entry struct {
 	data    []byte
 }
 
+type item struct {
+	token string
+	entry entry
+	used  uint64
+}
+
+// shard is a least recently used list guarded by its own lock. The front of order is the most recently used.
+type shard struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func (db *DB) shard(token string) *shard {
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(token))
+
+	return db.shards[h.Sum32()%uint32(len(db.shards))]
+}
+
+// remove deletes el from the shard, which must be locked.
+func (db *DB) remove(s *shard, el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*item).token)
+	db.count.Add(-1)
+}
+
+// evict removes the least recently used sessions of all the shards until the cap is respected.
+func (db *DB) evict() {
+
+	for db.max > 0 && db.count.Load() > int64(db.max) {
+
+		var (
+			oldest *shard
+			used   uint64
+		)
+
+		for _, s := range db.shards {
+
+			s.mu.Lock()
+
+			if back := s.order.Back(); back != nil {
+				if u := back.Value.(*item).used; oldest == nil || u < used {
+					oldest, used = s, u
+				}
+			}
+
+			s.mu.Unlock()
+		}
+
+		if oldest == nil {
+			return
+		}
+
+		oldest.mu.Lock()
+
+		if back := oldest.order.Back(); back != nil {
+			db.remove(oldest, back)
+		}
+
+		oldest.mu.Unlock()
+	}
+}
+
+// Len returns the amount of sessions kept.
+func (db *DB) Len() int {
+	return int(db.count.Load())
+}
+
 func (db *DB) Find(_ context.Context, token string) ([]byte, error) {
 
-	result, ok := db.entries[token]
+	s := db.shard(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[token]
 	if !ok {
-		return nil, errors.New("invalid token")
+		return nil, ErrNotFound
 	}
 
-	return result.data, nil
+	if !el.Value.(*item).entry.expires.After(time.Now()) {
+		db.remove(s, el)
+		return nil, ErrNotFound
+	}
+
+	el.Value.(*item).used = db.clock.Add(1)
+	s.order.MoveToFront(el)
+
+	return el.Value.(*item).entry.data, nil
 
 }
 
 func (db *DB) Delete(_ context.Context, token string) error {
 
-	maps.DeleteFunc(db.entries, func(s string, e entry) bool {
-		return s == token
-	})
+	s := db.shard(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[token]; ok {
+		db.remove(s, el)
+	}
 
 	return nil
 }
 
 func (db *DB) Add(_ context.Context, token string, data []byte, expires time.Time) error {
 
-	db.entries[token] = entry{
+	s := db.shard(token)
+
+	s.mu.Lock()
+
+	e := entry{
 		expires: expires,
 		data:    data,
 	}
 
+	if el, ok := s.entries[token]; ok {
+		el.Value.(*item).entry = e
+		el.Value.(*item).used = db.clock.Add(1)
+		s.order.MoveToFront(el)
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.entries[token] = s.order.PushFront(&item{token: token, entry: e, used: db.clock.Add(1)})
+	db.count.Add(1)
+
+	s.mu.Unlock()
+
+	// Evicting locks the other shards, so this one must be unlocked first.
+	db.evict()
+
 	return nil
 }
 
 func (db *DB) All(_ context.Context) (map[string][]byte, error) {
 
-	result := make(map[string][]byte, len(db.entries))
+	result := make(map[string][]byte)
+	now := time.Now()
+
+	for _, s := range db.shards {
+
+		s.mu.Lock()
+
+		for token, el := range s.entries {
+			if e := el.Value.(*item).entry; e.expires.After(now) {
+				result[token] = e.data
+			}
+		}
 
-	for token, entry := range db.entries {
-		result[token] = entry.data
+		s.mu.Unlock()
 	}
 
 	return result, nil
 }
 
-func (db *DB) DeleteOld(_ context.Context, old time.Time) error {
+// DeleteOld removes the sessions that expired at or before old.
+func (db *DB) DeleteOld(ctx context.Context, old time.Time) error {
+	_, err := db.Sweep(ctx, old)
+	return err
+}
 
-	maps.DeleteFunc(db.entries, func(s string, e entry) bool {
-		return e.expires.After(old)
-	})
+// Sweep removes the sessions that expired at or before old, returning how many were removed.
+func (db *DB) Sweep(_ context.Context, old time.Time) (int, error) {
 
-	return nil
+	removed := 0
+
+	for _, s := range db.shards {
+
+		s.mu.Lock()
+
+		for _, el := range s.entries {
+			if !el.Value.(*item).entry.expires.After(old) {
+				db.remove(s, el)
+				removed++
+			}
+		}
+
+		s.mu.Unlock()
+	}
+
+	return removed, nil
 }
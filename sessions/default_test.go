@@ -0,0 +1,196 @@
+package sessions_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/hcarriz/reverb/sessions/sessionstest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB(t *testing.T) {
+
+	sessionstest.Conformance(t, func(t *testing.T) sessions.Connection {
+		return sessions.NewDB()
+	})
+
+}
+
+func TestDBExpiry(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	db := sessions.NewDB()
+
+	check.NoError(db.Add(ctx, "expired", []byte("expired"), time.Now().Add(-time.Second)))
+	check.NoError(db.Add(ctx, "live", []byte("live"), time.Now().Add(time.Hour)))
+
+	removed, err := db.Sweep(ctx, time.Now())
+	check.NoError(err)
+	check.Equal(1, removed)
+	check.Equal(1, db.Len())
+
+	_, err = db.Find(ctx, "live")
+	check.NoError(err)
+
+	// Expired entries are not found, even before a sweep.
+	check.NoError(db.Add(ctx, "expired", []byte("expired"), time.Now().Add(-time.Second)))
+
+	_, err = db.Find(ctx, "expired")
+	check.ErrorIs(err, sessions.ErrNotFound)
+	check.Equal(1, db.Len())
+
+}
+
+func TestDBConcurrent(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	db := sessions.NewDB(sessions.Shards(4))
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < 32; g++ {
+
+		wg.Add(1)
+
+		go func(g int) {
+
+			defer wg.Done()
+
+			for x := 0; x < 200; x++ {
+
+				token := fmt.Sprintf("token_%d", (g*200+x)%500)
+
+				_ = db.Add(ctx, token, []byte(token), time.Now().Add(time.Hour))
+				_, _ = db.Find(ctx, token)
+
+				switch x % 10 {
+				case 0:
+					_ = db.Delete(ctx, token)
+				case 5:
+					_, _ = db.All(ctx)
+				case 9:
+					_ = db.DeleteOld(ctx, time.Now().Add(-time.Hour))
+				}
+			}
+
+		}(g)
+	}
+
+	wg.Wait()
+
+	check.LessOrEqual(db.Len(), 500)
+
+}
+
+func TestDBMaxEntries(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	db := sessions.NewDB(sessions.MaxEntries(1))
+
+	check.NoError(db.Add(ctx, "first", []byte("first"), time.Now().Add(time.Hour)))
+	check.NoError(db.Add(ctx, "second", []byte("second"), time.Now().Add(time.Hour)))
+
+	check.Equal(1, db.Len())
+
+	_, err := db.Find(ctx, "first")
+	check.ErrorIs(err, sessions.ErrNotFound)
+
+	// The least recently used entry is evicted, not the oldest one.
+	db = sessions.NewDB(sessions.MaxEntries(2), sessions.Shards(1))
+
+	check.NoError(db.Add(ctx, "a", []byte("a"), time.Now().Add(time.Hour)))
+	check.NoError(db.Add(ctx, "b", []byte("b"), time.Now().Add(time.Hour)))
+
+	_, err = db.Find(ctx, "a")
+	check.NoError(err)
+
+	check.NoError(db.Add(ctx, "c", []byte("c"), time.Now().Add(time.Hour)))
+
+	check.Equal(2, db.Len())
+
+	_, err = db.Find(ctx, "a")
+	check.NoError(err)
+
+	_, err = db.Find(ctx, "b")
+	check.ErrorIs(err, sessions.ErrNotFound)
+
+	// Replacing an entry does not count twice.
+	check.NoError(db.Add(ctx, "c", []byte("replaced"), time.Now().Add(time.Hour)))
+	check.Equal(2, db.Len())
+
+	// The cap is for the whole store, not for each shard.
+	db = sessions.NewDB(sessions.MaxEntries(100))
+
+	for x := 0; x < 100; x++ {
+		check.NoError(db.Add(ctx, fmt.Sprintf("token_%d", x), nil, time.Now().Add(time.Hour)))
+	}
+
+	check.Equal(100, db.Len())
+
+	all, err := db.All(ctx)
+	check.NoError(err)
+	check.Len(all, 100)
+
+	// Past the cap the least recently used of all the shards goes first.
+	_, err = db.Find(ctx, "token_0")
+	check.NoError(err)
+
+	for x := 100; x < 1000; x++ {
+		check.NoError(db.Add(ctx, fmt.Sprintf("token_%d", x), nil, time.Now().Add(time.Hour)))
+	}
+
+	check.Equal(100, db.Len())
+
+	_, err = db.Find(ctx, "token_1")
+	check.ErrorIs(err, sessions.ErrNotFound)
+
+	_, err = db.Find(ctx, "token_999")
+	check.NoError(err)
+
+}
+
+func TestStoreConcurrent(t *testing.T) {
+
+	check := require.New(t)
+
+	store, err := sessions.New(sessions.Cleanup(0))
+	check.NoError(err)
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < 16; g++ {
+
+		wg.Add(1)
+
+		go func(g int) {
+
+			defer wg.Done()
+
+			for x := 0; x < 100; x++ {
+				token := fmt.Sprintf("token_%d_%d", g, x)
+				_ = store.Commit(token, []byte(token), time.Now().Add(time.Hour))
+				_, _, _ = store.Find(token)
+				_, _ = store.All()
+				_ = store.Delete(token)
+			}
+
+		}(g)
+	}
+
+	wg.Wait()
+
+	all, err := store.All()
+	check.NoError(err)
+	check.Empty(all)
+
+}
@@ -0,0 +1,171 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	ErrNoKeys        = errors.New("at least one encryption key is required")
+	ErrInvalidKey    = errors.New("encryption keys must be 32 bytes")
+	ErrInvalidCipher = errors.New("invalid cipher")
+	ErrUnknownKey    = errors.New("session was encrypted with an unknown key")
+	ErrCiphertext    = errors.New("session data can not be decrypted")
+)
+
+// Cipher is the AEAD used to encrypt session data.
+type Cipher byte
+
+const (
+	// AESGCM is AES-256 in Galois/Counter Mode.
+	AESGCM Cipher = iota + 1
+	// XChaCha20Poly1305 is ChaCha20-Poly1305 with an extended nonce.
+	XChaCha20Poly1305
+)
+
+const keyIDSize = 4
+
+// key is an encryption key with an AEAD for every cipher, so data written before a cipher change can still be read.
+type key struct {
+	id    [keyIDSize]byte
+	aeads map[Cipher]cipher.AEAD
+}
+
+func newKey(secret []byte) (key, error) {
+
+	if len(secret) != 32 {
+		return key{}, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return key{}, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return key{}, err
+	}
+
+	xchacha, err := chacha20poly1305.NewX(secret)
+	if err != nil {
+		return key{}, err
+	}
+
+	sum := sha256.Sum256(secret)
+
+	k := key{
+		aeads: map[Cipher]cipher.AEAD{
+			AESGCM:            gcm,
+			XChaCha20Poly1305: xchacha,
+		},
+	}
+
+	copy(k.id[:], sum[:keyIDSize])
+
+	return k, nil
+}
+
+// Encrypt encrypts the session data before it reaches the Connection.
+// Every key must be 32 bytes. The first key encrypts, and any of them decrypts,
+// so keys are rotated by putting a new one first and keeping the old ones until their sessions expire.
+func Encrypt(c Cipher, keys ...[]byte) Option {
+	return option(func(s *Store) error {
+
+		if c != AESGCM && c != XChaCha20Poly1305 {
+			return ErrInvalidCipher
+		}
+
+		if len(keys) == 0 {
+			return ErrNoKeys
+		}
+
+		s.cipher = c
+		s.keys = make([]key, 0, len(keys))
+
+		for _, secret := range keys {
+
+			k, err := newKey(secret)
+			if err != nil {
+				return err
+			}
+
+			s.keys = append(s.keys, k)
+		}
+
+		return nil
+	})
+}
+
+// seal encrypts data stored under token. The result is the cipher, the key id, the nonce and the ciphertext.
+// What it is stored under is authenticated too, so data can not be moved to another session.
+func (s *Store) seal(token string, data []byte) ([]byte, error) {
+
+	if len(s.keys) == 0 {
+		return data, nil
+	}
+
+	current := s.keys[0]
+	aead := current.aeads[s.cipher]
+
+	header := append([]byte{byte(s.cipher)}, current.id[:]...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(header, nonce...)
+
+	return aead.Seal(out, nonce, data, additional(header, token)), nil
+}
+
+// open decrypts data stored under token with any of the keys.
+func (s *Store) open(token string, data []byte) ([]byte, error) {
+
+	if len(s.keys) == 0 {
+		return data, nil
+	}
+
+	if len(data) < 1+keyIDSize {
+		return nil, ErrCiphertext
+	}
+
+	header, rest := data[:1+keyIDSize], data[1+keyIDSize:]
+
+	for _, k := range s.keys {
+
+		if string(k.id[:]) != string(header[1:]) {
+			continue
+		}
+
+		aead, ok := k.aeads[Cipher(header[0])]
+		if !ok || len(rest) < aead.NonceSize() {
+			return nil, ErrCiphertext
+		}
+
+		plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], additional(header, token))
+		if err != nil {
+			return nil, ErrCiphertext
+		}
+
+		return plain, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func additional(header []byte, token string) []byte {
+	return append(append([]byte{}, header...), token...)
+}
+
+// redact describes data for the logs without revealing it.
+func (s *Store) redact(data []byte) slog.Attr {
+	return slog.Group("data", slog.Int("size", len(data)), slog.String("hmac", s.mac(data, 8)))
+}
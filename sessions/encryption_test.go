@@ -0,0 +1,198 @@
+package sessions_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T) []byte {
+
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestEncryptOptions(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		cipher sessions.Cipher
+		keys   [][]byte
+		err    error
+	}{
+		{"aes", sessions.AESGCM, [][]byte{newKey(t)}, nil},
+		{"xchacha", sessions.XChaCha20Poly1305, [][]byte{newKey(t), newKey(t)}, nil},
+		{"invalid cipher", sessions.Cipher(0), [][]byte{newKey(t)}, sessions.ErrInvalidCipher},
+		{"no keys", sessions.AESGCM, nil, sessions.ErrNoKeys},
+		{"short key", sessions.AESGCM, [][]byte{newKey(t), []byte("short")}, sessions.ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			_, err := sessions.New(sessions.Cleanup(0), sessions.Encrypt(tt.cipher, tt.keys...))
+			check.ErrorIs(err, tt.err)
+
+		})
+	}
+
+}
+
+func TestEncrypt(t *testing.T) {
+
+	for name, c := range map[string]sessions.Cipher{"aes": sessions.AESGCM, "xchacha": sessions.XChaCha20Poly1305} {
+		t.Run(name, func(t *testing.T) {
+
+			check := require.New(t)
+
+			ctx := context.Background()
+			db := sessions.NewDB()
+			secret := []byte("very secret session data")
+
+			store, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(c, newKey(t)))
+			check.NoError(err)
+
+			check.NoError(store.Commit("token", secret, time.Now().Add(time.Hour)))
+
+			raw, err := db.Find(ctx, "token")
+			check.NoError(err)
+			check.NotContains(string(raw), string(secret))
+
+			found, ok, err := store.Find("token")
+			check.NoError(err)
+			check.True(ok)
+			check.Equal(secret, found)
+
+			all, err := store.All()
+			check.NoError(err)
+			check.Equal(map[string][]byte{"token": secret}, all)
+
+			// The data is bound to its token.
+			check.NoError(db.Add(ctx, "other", raw, time.Now().Add(time.Hour)))
+
+			_, ok, err = store.Find("other")
+			check.NoError(err)
+			check.False(ok)
+
+			all, err = store.All()
+			check.NoError(err)
+			check.Len(all, 1)
+
+		})
+	}
+
+}
+
+func TestEncryptRotation(t *testing.T) {
+
+	check := require.New(t)
+
+	db := sessions.NewDB()
+	previous, current := newKey(t), newKey(t)
+
+	before, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.AESGCM, previous))
+	check.NoError(err)
+
+	check.NoError(before.Commit("old", []byte("old"), time.Now().Add(time.Hour)))
+
+	// The new key goes first, the old one stays to read existing sessions, and the cipher can change too.
+	after, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.XChaCha20Poly1305, current, previous))
+	check.NoError(err)
+
+	found, ok, err := after.Find("old")
+	check.NoError(err)
+	check.True(ok)
+	check.Equal([]byte("old"), found)
+
+	check.NoError(after.Commit("new", []byte("new"), time.Now().Add(time.Hour)))
+
+	_, ok, err = before.Find("new")
+	check.NoError(err)
+	check.False(ok)
+
+	// Once the old key is dropped its sessions are gone.
+	retired, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.XChaCha20Poly1305, current))
+	check.NoError(err)
+
+	_, ok, err = retired.Find("old")
+	check.NoError(err)
+	check.False(ok)
+
+	found, ok, err = retired.Find("new")
+	check.NoError(err)
+	check.True(ok)
+	check.Equal([]byte("new"), found)
+
+}
+
+func TestStoreRedactsLogs(t *testing.T) {
+
+	check := require.New(t)
+
+	var buf bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	store, err := sessions.New(sessions.Cleanup(0), sessions.Logger(logger))
+	check.NoError(err)
+
+	check.NoError(store.Commit("token", []byte("very secret session data"), time.Now().Add(time.Hour)))
+
+	_, ok, err := store.Find("token")
+	check.NoError(err)
+	check.True(ok)
+
+	check.NotContains(buf.String(), "very secret")
+	check.Contains(buf.String(), "data.size=24")
+
+	// Plain hashes could be matched against the logs of other services.
+	token := sha256.Sum256([]byte("token"))
+	data := sha256.Sum256([]byte("very secret session data"))
+
+	check.NotContains(buf.String(), hex.EncodeToString(token[:6]))
+	check.NotContains(buf.String(), hex.EncodeToString(data[:8]))
+
+	// Stores with different secrets do not log the same fingerprints.
+	fingerprints := func(secret []byte) string {
+
+		var buf bytes.Buffer
+
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))
+
+		store, err := sessions.New(sessions.Cleanup(0), sessions.HashTokens(secret), sessions.Logger(logger))
+		check.NoError(err)
+
+		_, _, err = store.Find("token")
+		check.NoError(err)
+
+		return buf.String()
+	}
+
+	secret := newKey(t)
+
+	check.Equal(fingerprints(secret), fingerprints(secret))
+	check.NotEqual(fingerprints(secret), fingerprints(newKey(t)))
+
+}
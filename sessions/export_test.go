@@ -0,0 +1,6 @@
+package sessions
+
+// PostgresQuery exposes the placeholder rewriting of SQL to the tests.
+func PostgresQuery(q string) string {
+	return (&SQL{dialect: Postgres}).query(q)
+}
@@ -0,0 +1,163 @@
+package sessions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+var (
+	ErrShortSecret   = errors.New("hash secret must be at least 32 bytes")
+	ErrMissingSecret = errors.New("migrating tokens requires HashTokens")
+	ErrNilCodec      = errors.New("codec is nil")
+)
+
+// HashTokens keeps sessions under an HMAC-SHA256 of the token instead of the token itself,
+// so the keys in the Connection can not be used as session cookies.
+// The secret must be at least 32 bytes, and changing it loses every session.
+//
+// scs.SessionManager.Iterate hands the keys back to the store, so use Store.Iterate instead.
+func HashTokens(secret []byte) Option {
+	return option(func(s *Store) error {
+
+		if len(secret) < 32 {
+			return ErrShortSecret
+		}
+
+		s.secret = secret
+
+		return nil
+	})
+}
+
+// MigrateTokens moves sessions that were stored before HashTokens under their hash when they are found.
+// The codec must be the one of the session manager, it is used to read the expiry of the session.
+func MigrateTokens(codec scs.Codec) Option {
+	return option(func(s *Store) error {
+
+		if codec == nil {
+			return ErrNilCodec
+		}
+
+		s.codec = codec
+
+		return nil
+	})
+}
+
+type iterationKey struct{}
+
+// iteration holds the keys that AllCtx handed to scs.SessionManager.Iterate, which are used as they are.
+type iteration struct {
+	keys map[string]struct{}
+}
+
+// Iterate is scs.SessionManager.Iterate for a manager using this store.
+// The manager hands the stored keys back to the store, so when HashTokens is used they must not be hashed again.
+// Only the keys of this iteration are, other tokens given to the store within fn are hashed as usual.
+func (s *Store) Iterate(ctx context.Context, manager *scs.SessionManager, fn func(context.Context) error) error {
+
+	if s.secret == nil {
+		return manager.Iterate(ctx, fn)
+	}
+
+	return manager.Iterate(context.WithValue(ctx, iterationKey{}, &iteration{}), fn)
+}
+
+// key returns what token is stored under.
+func (s *Store) key(ctx context.Context, token string) string {
+
+	if s.secret == nil {
+		return token
+	}
+
+	if it, ok := ctx.Value(iterationKey{}).(*iteration); ok {
+		if _, found := it.keys[token]; found {
+			return token
+		}
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	_, _ = mac.Write([]byte(token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// fingerprint describes a storage key for the logs, enough to tell sessions apart but not to use them.
+func (s *Store) fingerprint(key string) slog.Attr {
+	return slog.String("token", s.mac([]byte(key), 6))
+}
+
+// mac returns the first size bytes of an HMAC of data, keyed so the logs of other stores can not be correlated.
+func (s *Store) mac(data []byte, size int) string {
+
+	mac := hmac.New(sha256.New, s.logKey)
+	_, _ = mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil)[:size])
+}
+
+// newLogKey derives the key of the log fingerprints from the HashTokens secret,
+// or makes a random one that only lasts as long as the store.
+func newLogKey(secret []byte) ([]byte, error) {
+
+	if secret != nil {
+		mac := hmac.New(sha256.New, secret)
+		_, _ = mac.Write([]byte("log fingerprint"))
+		return mac.Sum(nil), nil
+	}
+
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// migrate looks for a session stored under its clear token, moving it under key.
+// Legacy data that can not be read is ErrNotFound, like in FindCtx, other errors come from the connection.
+func (s *Store) migrate(ctx context.Context, token, key string) ([]byte, error) {
+
+	data, err := s.db.Find(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := s.open(token, data)
+	if err != nil {
+		s.logger.WarnContext(ctx, "unable to decrypt token", s.fingerprint(key), slog.String("error", err.Error()))
+		return nil, ErrNotFound
+	}
+
+	expires, _, err := s.codec.Decode(plain)
+	if err != nil {
+		s.logger.WarnContext(ctx, "unable to decode token", s.fingerprint(key), slog.String("error", err.Error()))
+		return nil, ErrNotFound
+	}
+
+	sealed, err := s.seal(key, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Add(ctx, key, sealed, expires); err != nil {
+		return nil, err
+	}
+
+	// The session is already under key, the old copy expires on its own or with the next sweep.
+	if err := s.db.Delete(ctx, token); err != nil {
+		s.logger.WarnContext(ctx, "unable to delete migrated token", s.fingerprint(key), slog.String("error", err.Error()))
+	}
+
+	s.logger.InfoContext(ctx, "migrated token", s.fingerprint(key))
+
+	return plain, nil
+}
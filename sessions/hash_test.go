@@ -0,0 +1,237 @@
+package sessions_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashTokensOptions(t *testing.T) {
+
+	check := require.New(t)
+
+	_, err := sessions.New(sessions.Cleanup(0), sessions.HashTokens([]byte("short")))
+	check.ErrorIs(err, sessions.ErrShortSecret)
+
+	_, err = sessions.New(sessions.Cleanup(0), sessions.MigrateTokens(nil))
+	check.ErrorIs(err, sessions.ErrNilCodec)
+
+	_, err = sessions.New(sessions.Cleanup(0), sessions.MigrateTokens(scs.GobCodec{}))
+	check.ErrorIs(err, sessions.ErrMissingSecret)
+
+}
+
+func TestHashTokens(t *testing.T) {
+
+	check := require.New(t)
+
+	var buf bytes.Buffer
+
+	ctx := context.Background()
+	db := sessions.NewDB()
+	token := "clear-session-token"
+
+	store, err := sessions.New(
+		sessions.Cleanup(0),
+		sessions.Database(db),
+		sessions.HashTokens(newKey(t)),
+		sessions.Encrypt(sessions.AESGCM, newKey(t)),
+		sessions.Logger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	check.NoError(err)
+
+	check.NoError(store.Commit(token, []byte("data"), time.Now().Add(time.Hour)))
+
+	_, err = db.Find(ctx, token)
+	check.ErrorIs(err, sessions.ErrNotFound)
+
+	raw, err := db.All(ctx)
+	check.NoError(err)
+	check.Len(raw, 1)
+
+	for key := range raw {
+		check.Len(key, 64)
+	}
+
+	data, ok, err := store.Find(token)
+	check.NoError(err)
+	check.True(ok)
+	check.Equal([]byte("data"), data)
+
+	check.NoError(store.Delete(token))
+	check.Zero(db.Len())
+
+	check.NotEmpty(buf.String())
+	check.NotContains(buf.String(), token)
+
+}
+
+func TestMigrateTokens(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	db := sessions.NewDB()
+	secret, encryption := newKey(t), newKey(t)
+
+	before, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.AESGCM, encryption))
+	check.NoError(err)
+
+	manager := scs.New()
+	manager.Store = before
+
+	loaded, err := manager.Load(ctx, "")
+	check.NoError(err)
+
+	manager.Put(loaded, "user", "gopher")
+
+	token, expires, err := manager.Commit(loaded)
+	check.NoError(err)
+
+	// Without MigrateTokens the old session is not found.
+	hashed, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.AESGCM, encryption), sessions.HashTokens(secret))
+	check.NoError(err)
+
+	_, ok, err := hashed.Find(token)
+	check.NoError(err)
+	check.False(ok)
+
+	after, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.AESGCM, encryption), sessions.HashTokens(secret), sessions.MigrateTokens(scs.GobCodec{}))
+	check.NoError(err)
+
+	manager.Store = after
+
+	loaded, err = manager.Load(ctx, token)
+	check.NoError(err)
+	check.Equal("gopher", manager.GetString(loaded, "user"))
+
+	// The session moved under its hash, keeping its expiry.
+	_, err = db.Find(ctx, token)
+	check.ErrorIs(err, sessions.ErrNotFound)
+	check.Equal(1, db.Len())
+
+	_, ok, err = hashed.Find(token)
+	check.NoError(err)
+	check.True(ok)
+
+	deadline, _, err := scs.GobCodec{}.Decode(mustFind(t, hashed, token))
+	check.NoError(err)
+	check.WithinDuration(expires, deadline, time.Second)
+
+	_, ok, err = after.Find("missing")
+	check.NoError(err)
+	check.False(ok)
+
+}
+
+// outage fails every Add, as a database that went down would.
+type outage struct {
+	*sessions.DB
+}
+
+func (outage) Add(context.Context, string, []byte, time.Time) error {
+	return errors.New("database is down")
+}
+
+func TestMigrateTokensErrors(t *testing.T) {
+
+	check := require.New(t)
+
+	db := sessions.NewDB()
+	secret, encryption := newKey(t), newKey(t)
+
+	before, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.AESGCM, encryption))
+	check.NoError(err)
+
+	manager := scs.New()
+	manager.Store = before
+
+	loaded, err := manager.Load(context.Background(), "")
+	check.NoError(err)
+
+	manager.Put(loaded, "user", "gopher")
+
+	token, _, err := manager.Commit(loaded)
+	check.NoError(err)
+
+	// A failing database is an error, not a missing session.
+	down, err := sessions.New(sessions.Cleanup(0), sessions.Database(outage{db}), sessions.Encrypt(sessions.AESGCM, encryption), sessions.HashTokens(secret), sessions.MigrateTokens(scs.GobCodec{}))
+	check.NoError(err)
+
+	_, ok, err := down.Find(token)
+	check.ErrorContains(err, "database is down")
+	check.False(ok)
+
+	// Legacy data that can not be decrypted is just missing.
+	other, err := sessions.New(sessions.Cleanup(0), sessions.Database(db), sessions.Encrypt(sessions.AESGCM, newKey(t)), sessions.HashTokens(secret), sessions.MigrateTokens(scs.GobCodec{}))
+	check.NoError(err)
+
+	_, ok, err = other.Find(token)
+	check.NoError(err)
+	check.False(ok)
+}
+
+func TestHashedIterate(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+
+	store, err := sessions.New(sessions.Cleanup(0), sessions.HashTokens(newKey(t)))
+	check.NoError(err)
+
+	manager := scs.New()
+	manager.Store = store
+
+	var tokens []string
+
+	for _, user := range []string{"alice", "bob", "alice"} {
+
+		loaded, err := manager.Load(ctx, "")
+		check.NoError(err)
+
+		manager.Put(loaded, "user", user)
+
+		token, _, err := manager.Commit(loaded)
+		check.NoError(err)
+
+		tokens = append(tokens, token)
+	}
+
+	check.NoError(store.Iterate(ctx, manager, func(ctx context.Context) error {
+
+		// A token that is not part of the iteration is still hashed.
+		_, found, err := store.FindCtx(ctx, tokens[1])
+		check.NoError(err)
+		check.True(found)
+
+		if manager.GetString(ctx, "user") != "alice" {
+			return nil
+		}
+
+		return manager.Destroy(ctx)
+	}))
+
+	for x, token := range tokens {
+		_, ok, err := store.Find(token)
+		check.NoError(err)
+		check.Equal(x == 1, ok)
+	}
+
+}
+
+func mustFind(t *testing.T, store *sessions.Store, token string) []byte {
+
+	data, ok, err := store.Find(token)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	return data
+}
@@ -0,0 +1,437 @@
+package sessions
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEmptyAddress    = errors.New("redis address is empty")
+	ErrInvalidPoolSize = errors.New("pool size must be positive")
+	ErrInvalidReply    = errors.New("invalid redis reply")
+)
+
+// RedisError is an error reply sent by the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// RedisOption configures NewRedis.
+type RedisOption interface {
+	apply(*Redis) error
+}
+
+type redisOption func(*Redis) error
+
+func (o redisOption) apply(r *Redis) error {
+	return o(r)
+}
+
+// Prefix is put in front of every token to make the key, the default is "session:".
+func Prefix(prefix string) RedisOption {
+	return redisOption(func(r *Redis) error {
+		r.prefix = prefix
+		return nil
+	})
+}
+
+// Password authenticates new connections with AUTH.
+func Password(password string) RedisOption {
+	return redisOption(func(r *Redis) error {
+		r.password = password
+		return nil
+	})
+}
+
+// RedisDatabase selects the numbered database for new connections.
+func RedisDatabase(index int) RedisOption {
+	return redisOption(func(r *Redis) error {
+		r.database = index
+		return nil
+	})
+}
+
+// PoolSize sets how many idle connections are kept, the default is 8.
+func PoolSize(size int) RedisOption {
+	return redisOption(func(r *Redis) error {
+
+		if size < 1 {
+			return ErrInvalidPoolSize
+		}
+
+		r.pool = make(chan *redisConn, size)
+
+		return nil
+	})
+}
+
+// Redis is a Connection speaking the Redis protocol (RESP), i.e. to Redis, Valkey or KeyDB.
+// Sessions expire on their own on the server, so DeleteOld has nothing to do.
+type Redis struct {
+	addr     string
+	prefix   string
+	password string
+	database int
+	dialer   net.Dialer
+	pool     chan *redisConn
+}
+
+// NewRedis returns a Connection to the server at addr, checking that it answers.
+func NewRedis(ctx context.Context, addr string, opts ...RedisOption) (*Redis, error) {
+
+	if addr == "" {
+		return nil, ErrEmptyAddress
+	}
+
+	r := &Redis{
+		addr:   addr,
+		prefix: "session:",
+		pool:   make(chan *redisConn, 8),
+	}
+
+	var err error
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(r))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.do(ctx, "PING"); err != nil {
+		return nil, errors.Join(err, r.Close())
+	}
+
+	return r, nil
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func (r *Redis) get(ctx context.Context) (*redisConn, error) {
+
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+
+	conn, err := r.dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	if r.password != "" {
+		if _, err := c.do(ctx, "AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if r.database != 0 {
+		if _, err := c.do(ctx, "SELECT", strconv.Itoa(r.database)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// put returns the connection to the pool, unless it failed in a way that leaves it unusable.
+func (r *Redis) put(c *redisConn, err error) {
+
+	var reply RedisError
+
+	if err != nil && !errors.As(err, &reply) {
+		c.conn.Close()
+		return
+	}
+
+	select {
+	case r.pool <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.do(ctx, args...)
+
+	r.put(c, err)
+
+	return result, err
+}
+
+// Ping checks that the server is reachable.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+
+	var err error
+
+	for {
+		select {
+		case c := <-r.pool:
+			err = errors.Join(err, c.conn.Close())
+		default:
+			return err
+		}
+	}
+}
+
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+
+	// Without a deadline the zero time clears the previous one.
+	deadline, _ := ctx.Deadline()
+
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.r)
+}
+
+// readReply reads one reply. Bulk strings are returned as []byte, and nil replies as nil.
+func readReply(r *bufio.Reader) (any, error) {
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, ErrInvalidReply
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, RedisError(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrInvalidReply
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		return b[:size], nil
+
+	case '*':
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrInvalidReply
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		result := make([]any, size)
+
+		// Error elements are returned after the whole array is read, so the next reply starts where it should.
+		var reply error
+
+		for x := range result {
+
+			result[x], err = readReply(r)
+
+			var element RedisError
+
+			switch {
+			case errors.As(err, &element):
+				if reply == nil {
+					reply = err
+				}
+			case err != nil:
+				return nil, err
+			}
+		}
+
+		if reply != nil {
+			return nil, reply
+		}
+
+		return result, nil
+	}
+
+	return nil, ErrInvalidReply
+}
+
+func (r *Redis) Find(ctx context.Context, token string) ([]byte, error) {
+
+	result, err := r.do(ctx, "GET", r.prefix+token)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, ErrNotFound
+	}
+
+	data, ok := result.([]byte)
+	if !ok {
+		return nil, ErrInvalidReply
+	}
+
+	return data, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, token string) error {
+	_, err := r.do(ctx, "DEL", r.prefix+token)
+	return err
+}
+
+// Add sets the session with a millisecond TTL. Sessions that already expired are deleted instead.
+func (r *Redis) Add(ctx context.Context, token string, data []byte, expires time.Time) error {
+
+	ttl := time.Until(expires).Milliseconds()
+	if ttl <= 0 {
+		return r.Delete(ctx, token)
+	}
+
+	_, err := r.do(ctx, "SET", r.prefix+token, string(data), "PX", strconv.FormatInt(ttl, 10))
+
+	return err
+}
+
+// All walks the keys with SCAN, so it does not block the server like KEYS would.
+func (r *Redis) All(ctx context.Context) (map[string][]byte, error) {
+
+	result := make(map[string][]byte)
+	cursor := "0"
+	match := escapeGlob(r.prefix) + "*"
+
+	for {
+
+		reply, err := r.do(ctx, "SCAN", cursor, "MATCH", match, "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return nil, ErrInvalidReply
+		}
+
+		next, ok := parts[0].([]byte)
+		if !ok {
+			return nil, ErrInvalidReply
+		}
+
+		keys, ok := parts[1].([]any)
+		if !ok {
+			return nil, ErrInvalidReply
+		}
+
+		if len(keys) > 0 {
+
+			args := []string{"MGET"}
+
+			for _, key := range keys {
+
+				b, ok := key.([]byte)
+				if !ok {
+					return nil, ErrInvalidReply
+				}
+
+				args = append(args, string(b))
+			}
+
+			reply, err := r.do(ctx, args...)
+			if err != nil {
+				return nil, err
+			}
+
+			values, ok := reply.([]any)
+			if !ok || len(values) != len(keys) {
+				return nil, ErrInvalidReply
+			}
+
+			for x, value := range values {
+				// The key expired between SCAN and MGET.
+				if data, ok := value.([]byte); ok {
+					result[strings.TrimPrefix(args[x+1], r.prefix)] = data
+				}
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" {
+			return result, nil
+		}
+	}
+}
+
+// DeleteOld does nothing, the server expires sessions on its own.
+func (r *Redis) DeleteOld(context.Context, time.Time) error {
+	return nil
+}
+
+func escapeGlob(s string) string {
+
+	var b strings.Builder
+
+	for _, r := range s {
+
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package sessions_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/hcarriz/reverb/sessions/sessionstest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+
+	sessionstest.Conformance(t, func(t *testing.T) sessions.Connection {
+
+		check := require.New(t)
+
+		conn, err := sessions.NewRedis(context.Background(), sessionstest.RedisServer(t, "secret"), sessions.Password("secret"), sessions.RedisDatabase(1))
+		check.NoError(err)
+
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	})
+
+}
+
+func TestNewRedis(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	addr := sessionstest.RedisServer(t, "secret")
+
+	_, err := sessions.NewRedis(ctx, "")
+	check.ErrorIs(err, sessions.ErrEmptyAddress)
+
+	_, err = sessions.NewRedis(ctx, addr, sessions.PoolSize(0))
+	check.ErrorIs(err, sessions.ErrInvalidPoolSize)
+
+	var reply sessions.RedisError
+
+	_, err = sessions.NewRedis(ctx, addr)
+	check.ErrorAs(err, &reply)
+
+	_, err = sessions.NewRedis(ctx, addr, sessions.Password("wrong"))
+	check.ErrorAs(err, &reply)
+
+	conn, err := sessions.NewRedis(ctx, addr, sessions.Password("secret"), sessions.PoolSize(1))
+	check.NoError(err)
+	check.NoError(conn.Close())
+
+}
+
+func TestRedisAll(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	addr := sessionstest.RedisServer(t, "")
+
+	conn, err := sessions.NewRedis(ctx, addr, sessions.Prefix("app[1]:"))
+	check.NoError(err)
+
+	other, err := sessions.NewRedis(ctx, addr, sessions.Prefix("other:"))
+	check.NoError(err)
+
+	// More than one page of SCAN.
+	for x := 0; x < 250; x++ {
+		check.NoError(conn.Add(ctx, fmt.Sprintf("token_%d", x), []byte("data"), time.Now().Add(time.Hour)))
+	}
+
+	check.NoError(other.Add(ctx, "token_0", []byte("other"), time.Now().Add(time.Hour)))
+
+	all, err := conn.All(ctx)
+	check.NoError(err)
+	check.Len(all, 250)
+	check.Equal([]byte("data"), all["token_0"])
+
+	all, err = other.All(ctx)
+	check.NoError(err)
+	check.Equal(map[string][]byte{"token_0": []byte("other")}, all)
+
+	// The server expires sessions on its own.
+	check.NoError(conn.Add(ctx, "short", []byte("short"), time.Now().Add(20*time.Millisecond)))
+
+	check.Eventually(func() bool {
+		_, err := conn.Find(ctx, "short")
+		return err == sessions.ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+
+	check.NoError(conn.DeleteOld(ctx, time.Now()))
+
+}
+
+func TestRedisPing(t *testing.T) {
+
+	check := require.New(t)
+
+	conn, err := sessions.NewRedis(context.Background(), sessionstest.RedisServer(t, ""))
+	check.NoError(err)
+
+	t.Cleanup(func() { conn.Close() })
+
+	store, err := sessions.New(sessions.Cleanup(0), sessions.Database(conn))
+	check.NoError(err)
+
+	check.NoError(store.Ping(context.Background()))
+
+}
+
+// scripted answers each command with the next reply, whatever the command is.
+func scripted(t *testing.T, replies ...string) string {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+
+		for _, reply := range replies {
+
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			// Skip the length and value of every argument.
+			args, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			for x := 0; x < args*2; x++ {
+				if _, err := r.ReadString('\n'); err != nil {
+					return
+				}
+			}
+
+			if _, err := io.WriteString(conn, reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestRedisArrayError(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+
+	addr := scripted(t,
+		"+PONG\r\n",
+		"*3\r\n-ERR first\r\n-ERR second\r\n$4\r\ndata\r\n",
+		"+PONG\r\n",
+	)
+
+	conn, err := sessions.NewRedis(ctx, addr)
+	check.NoError(err)
+
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = conn.All(ctx)
+
+	var reply sessions.RedisError
+	check.ErrorAs(err, &reply)
+	check.Equal(sessions.RedisError("ERR first"), reply)
+
+	// The connection went back to the pool, the rest of the array must not be read as the next reply.
+	check.NoError(conn.Ping(ctx))
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"sync"
 	"time"
+
+	"github.com/alexedwards/scs/v2"
 )
 
+var ErrNilContext = errors.New("context is nil")
+
 // Option
 type Option interface {
 	apply(*Store) error
@@ -51,6 +56,20 @@ func Logger(logger *slog.Logger) Option {
 	})
 }
 
+// Context stops the cleanup goroutine once ctx is done.
+func Context(ctx context.Context) Option {
+	return option(func(s *Store) error {
+
+		if ctx == nil {
+			return ErrNilContext
+		}
+
+		s.parent = ctx
+
+		return nil
+	})
+}
+
 type Connection interface {
 	Find(context.Context, string) ([]byte, error)
 	Delete(context.Context, string) error
@@ -59,12 +78,51 @@ type Connection interface {
 	DeleteOld(context.Context, time.Time) error
 }
 
+// Sweeper is implemented by the connections that can report how many sessions DeleteOld would remove.
+// Store.Sweep uses it when available, otherwise the sweeps are counted without removals.
+type Sweeper interface {
+	// Sweep removes the sessions that expired at or before the time, returning how many were removed.
+	Sweep(context.Context, time.Time) (int, error)
+}
+
+// Pinger is implemented by the connections that can report if they are reachable.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// Stats describes the work done by the cleanup sweeps.
+type Stats struct {
+	Sweeps      uint64
+	Removed     uint64
+	Failures    uint64
+	LastSweep   time.Time
+	LastRemoved int
+}
+
+var (
+	_ scs.CtxStore         = (*Store)(nil)
+	_ scs.IterableStore    = (*Store)(nil)
+	_ scs.IterableCtxStore = (*Store)(nil)
+
+	_ Sweeper = (*DB)(nil)
+	_ Sweeper = (*SQL)(nil)
+)
+
 type Store struct {
 	cleanup time.Duration
 	timeout time.Duration
-	stop    chan bool
 	logger  *slog.Logger
 	db      Connection
+	parent  context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	stats   Stats
+	cipher  Cipher
+	keys    []key
+	secret  []byte
+	logKey  []byte
+	codec   scs.Codec
 }
 
 func New(opts ...Option) (*Store, error) {
@@ -74,82 +132,156 @@ func New(opts ...Option) (*Store, error) {
 		timeout: 1 * time.Minute,
 		cleanup: 5 * time.Minute,
 		db:      NewDB(),
+		parent:  context.Background(),
 	}
 
 	var err error
 	for _, opt := range opts {
-		err = errors.Join(opt.apply(s))
+		err = errors.Join(err, opt.apply(s))
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	if s.codec != nil && s.secret == nil {
+		return nil, ErrMissingSecret
+	}
+
+	if s.logKey, err = newLogKey(s.secret); err != nil {
+		return nil, err
+	}
+
 	if s.cleanup > 0 {
-		go s.startCleanup()
+
+		ctx, cancel := context.WithCancel(s.parent)
+
+		s.cancel = cancel
+		s.done = make(chan struct{})
+
+		go s.startCleanup(ctx)
 	}
 
 	return s, nil
 }
 
+// Find satisfies scs.Store, it is FindCtx with a background context.
 func (s *Store) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of the session, with found set to false when it does not exist, has expired or can not be decrypted.
+func (s *Store) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(s.timeout))
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	result, err := s.db.Find(ctx, token)
+	key := s.key(ctx, token)
+
+	result, err := s.db.Find(ctx, key)
+	if errors.Is(err, ErrNotFound) && s.codec != nil && key != token {
+
+		result, err = s.migrate(ctx, token, key)
+		if err == nil {
+			return result, true, nil
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			s.logger.ErrorContext(ctx, "unable to migrate token", s.fingerprint(key), slog.String("error", err.Error()))
+			return nil, false, err
+		}
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		s.logger.DebugContext(ctx, "token not found", s.fingerprint(key))
+		return nil, false, nil
+	}
+
 	if err != nil {
-		s.logger.ErrorContext(ctx, "unable to find token", slog.String("token", token), slog.String("error", err.Error()))
+		s.logger.ErrorContext(ctx, "unable to find token", s.fingerprint(key), slog.String("error", err.Error()))
 		return nil, false, err
 	}
 
-	s.logger.DebugContext(ctx, "found token", slog.String("token", token))
+	result, err = s.open(key, result)
+	if err != nil {
+		s.logger.WarnContext(ctx, "unable to decrypt token", s.fingerprint(key), slog.String("error", err.Error()))
+		return nil, false, nil
+	}
+
+	s.logger.DebugContext(ctx, "found token", s.fingerprint(key), s.redact(result))
 
 	return result, true, nil
 
 }
 
+// Delete satisfies scs.Store, it is DeleteCtx with a background context.
 func (s *Store) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx removes the session.
+func (s *Store) DeleteCtx(ctx context.Context, token string) error {
 
 	now := time.Now()
 
-	ctx, cancel := context.WithDeadline(context.Background(), now.Add(s.timeout))
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	if err := s.db.Delete(ctx, token); err != nil {
-		s.logger.ErrorContext(ctx, "unable to delete token", slog.String("token", token), slog.String("error", err.Error()))
+	key := s.key(ctx, token)
+
+	if err := s.db.Delete(ctx, key); err != nil {
+		s.logger.ErrorContext(ctx, "unable to delete token", s.fingerprint(key), slog.String("error", err.Error()))
 		return err
 	}
 
-	s.logger.DebugContext(ctx, "token deleted", slog.String("token", token), slog.Time("when", now))
+	s.logger.DebugContext(ctx, "token deleted", s.fingerprint(key), slog.Time("when", now))
 
 	return nil
 
 }
 
+// Commit satisfies scs.Store, it is CommitCtx with a background context.
 func (s *Store) Commit(token string, data []byte, expires time.Time) error {
+	return s.CommitCtx(context.Background(), token, data, expires)
+}
+
+// CommitCtx adds or replaces the session.
+func (s *Store) CommitCtx(ctx context.Context, token string, data []byte, expires time.Time) error {
 
 	now := time.Now()
 
-	ctx, cancel := context.WithDeadline(context.Background(), now.Add(s.timeout))
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	if err := s.db.Add(ctx, token, data, expires); err != nil {
-		s.logger.ErrorContext(ctx, "unable to add token", slog.String("token", token), slog.String("data", string(data)), slog.String("error", err.Error()))
+	key := s.key(ctx, token)
+
+	sealed, err := s.seal(key, data)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "unable to encrypt token", s.fingerprint(key), s.redact(data), slog.String("error", err.Error()))
+		return err
+	}
+
+	if err := s.db.Add(ctx, key, sealed, expires); err != nil {
+		s.logger.ErrorContext(ctx, "unable to add token", s.fingerprint(key), s.redact(data), slog.String("error", err.Error()))
 		return err
 	}
 
-	s.logger.DebugContext(ctx, "committed token", slog.String("token", token), slog.String("data", string(data)), slog.Time("expires", expires), slog.Time("added", now))
+	s.logger.DebugContext(ctx, "committed token", s.fingerprint(key), s.redact(data), slog.Time("expires", expires), slog.Time("added", now))
 
 	return nil
 
 }
 
+// All satisfies scs.IterableStore, it is AllCtx with a background context.
 func (s *Store) All() (map[string][]byte, error) {
+	return s.AllCtx(context.Background())
+}
 
-	now := time.Now()
+// AllCtx returns the data of every session that has not expired, keyed by what they are stored under.
+// It is what scs.SessionManager.Iterate uses, see Store.Iterate when HashTokens is used.
+func (s *Store) AllCtx(ctx context.Context) (map[string][]byte, error) {
 
-	ctx, cancel := context.WithDeadline(context.Background(), now.Add(s.timeout))
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	result, err := s.db.All(ctx)
@@ -158,47 +290,136 @@ func (s *Store) All() (map[string][]byte, error) {
 		return nil, err
 	}
 
+	for token, data := range result {
+
+		plain, err := s.open(token, data)
+		if err != nil {
+			s.logger.WarnContext(ctx, "unable to decrypt token", s.fingerprint(token), slog.String("error", err.Error()))
+			delete(result, token)
+			continue
+		}
+
+		result[token] = plain
+	}
+
+	if it, ok := ctx.Value(iterationKey{}).(*iteration); ok {
+
+		it.keys = make(map[string]struct{}, len(result))
+
+		for token := range result {
+			it.keys[token] = struct{}{}
+		}
+	}
+
 	s.logger.DebugContext(ctx, "found tokens", slog.Int("amount", len(result)))
 
 	return result, nil
 
 }
 
-func (s *Store) startCleanup() {
+func (s *Store) startCleanup(ctx context.Context) {
 
-	s.stop = make(chan bool)
+	defer close(s.done)
 
-	if s.cleanup > 0 {
+	ticker := time.NewTicker(s.cleanup)
+	defer ticker.Stop()
 
-		ticker := time.NewTicker(s.cleanup)
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = s.Sweep(ctx)
+
+		case <-ctx.Done():
+			s.logger.Info("stopping ticker")
+			return
+		}
+	}
 
-		for {
-			select {
-			case <-ticker.C:
+}
 
-				s.logger.Debug("deleting sessions")
+// Sweep deletes the expired sessions once, returning how many were removed.
+// It is called periodically when Cleanup is positive.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
 
-				ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(s.timeout))
-				defer cancel()
+	now := time.Now()
 
-				if err := s.db.DeleteOld(ctx, time.Now()); err != nil {
-					s.logger.ErrorContext(ctx, "unable to delete old tokens", slog.String("error", err.Error()))
-				}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-			case <-s.stop:
-				s.logger.Info("stopping ticker")
-				ticker.Stop()
-				return
-			}
-		}
+	var (
+		removed int
+		err     error
+	)
 
+	if sweeper, ok := s.db.(Sweeper); ok {
+		removed, err = sweeper.Sweep(ctx, now)
+	} else {
+		err = s.db.DeleteOld(ctx, now)
 	}
 
+	s.mu.Lock()
+	s.stats.Sweeps++
+	s.stats.Removed += uint64(removed)
+	s.stats.LastSweep = now
+	s.stats.LastRemoved = removed
+	if err != nil {
+		s.stats.Failures++
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.ErrorContext(ctx, "unable to delete old tokens", slog.Int("removed", removed), slog.String("error", err.Error()))
+		return removed, err
+	}
+
+	s.logger.DebugContext(ctx, "deleted old tokens", slog.Int("removed", removed), slog.Duration("took", time.Since(now)))
+
+	return removed, nil
+}
+
+// Ping reports if the connection is reachable, for health checks. Connections that are not a Pinger always are.
+func (s *Store) Ping(ctx context.Context) error {
+
+	p, ok := s.db.(Pinger)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return p.Ping(ctx)
+}
+
+// Stats returns the totals of the sweeps done so far.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Close stops the cleanup goroutine and waits for it to return, or for ctx to be done.
+// It is safe to call more than once, and when cleanup is disabled.
+func (s *Store) Close(ctx context.Context) error {
+
+	if s.cancel == nil {
+		return nil
+	}
+
+	s.cancel()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+// StopCleanup stops the cleanup goroutine and waits for it to return.
 func (s *Store) StopCleanup() {
-	if s.stop != nil {
-		s.stop <- true
+	if s.cancel != nil {
+		_ = s.Close(context.Background())
 		s.logger.Info("cleanup stopped")
 	}
 }
@@ -0,0 +1,222 @@
+package sessions_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreFind(t *testing.T) {
+
+	check := require.New(t)
+
+	store, err := sessions.New(sessions.Cleanup(0))
+	check.NoError(err)
+
+	data, ok, err := store.Find("missing")
+	check.NoError(err)
+	check.False(ok)
+	check.Nil(data)
+
+	check.NoError(store.Commit("expired", []byte("expired"), time.Now().Add(-time.Second)))
+
+	data, ok, err = store.Find("expired")
+	check.NoError(err)
+	check.False(ok)
+	check.Nil(data)
+
+	check.NoError(store.Commit("live", []byte("live"), time.Now().Add(time.Hour)))
+
+	data, ok, err = store.Find("live")
+	check.NoError(err)
+	check.True(ok)
+	check.Equal([]byte("live"), data)
+
+}
+
+func TestStoreSweep(t *testing.T) {
+
+	check := require.New(t)
+
+	store, err := sessions.New(sessions.Cleanup(0))
+	check.NoError(err)
+
+	check.NoError(store.Commit("first", nil, time.Now().Add(-time.Second)))
+	check.NoError(store.Commit("second", nil, time.Now().Add(-time.Second)))
+	check.NoError(store.Commit("live", nil, time.Now().Add(time.Hour)))
+
+	removed, err := store.Sweep(context.Background())
+	check.NoError(err)
+	check.Equal(2, removed)
+
+	removed, err = store.Sweep(context.Background())
+	check.NoError(err)
+	check.Zero(removed)
+
+	stats := store.Stats()
+	check.Equal(uint64(2), stats.Sweeps)
+	check.Equal(uint64(2), stats.Removed)
+	check.Zero(stats.Failures)
+	check.Zero(stats.LastRemoved)
+	check.False(stats.LastSweep.IsZero())
+
+	_, ok, err := store.Find("live")
+	check.NoError(err)
+	check.True(ok)
+
+}
+
+func TestStoreClose(t *testing.T) {
+
+	check := require.New(t)
+
+	// Nothing to stop when cleanup is disabled.
+	store, err := sessions.New(sessions.Cleanup(0))
+	check.NoError(err)
+	check.NoError(store.Close(context.Background()))
+	store.StopCleanup()
+
+	store, err = sessions.New(sessions.Cleanup(time.Millisecond))
+	check.NoError(err)
+
+	check.NoError(store.Commit("expired", nil, time.Now().Add(-time.Second)))
+
+	check.Eventually(func() bool {
+		return store.Stats().Removed == 1
+	}, time.Second, time.Millisecond)
+
+	check.NoError(store.Close(context.Background()))
+	check.NoError(store.Close(context.Background()))
+	store.StopCleanup()
+
+	// The cleanup stops with the context given to New.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	store, err = sessions.New(sessions.Cleanup(time.Millisecond), sessions.Context(ctx))
+	check.NoError(err)
+
+	cancel()
+
+	check.NoError(store.Close(context.Background()))
+
+	_, err = sessions.New(sessions.Context(nil))
+	check.ErrorIs(err, sessions.ErrNilContext)
+
+}
+
+type ctxKey struct{}
+
+// recorder remembers the request value and deadline of the contexts it is called with.
+type recorder struct {
+	*sessions.DB
+	values    []any
+	deadlines []bool
+}
+
+func (r *recorder) record(ctx context.Context) {
+	_, ok := ctx.Deadline()
+	r.values = append(r.values, ctx.Value(ctxKey{}))
+	r.deadlines = append(r.deadlines, ok)
+}
+
+func (r *recorder) Find(ctx context.Context, token string) ([]byte, error) {
+	r.record(ctx)
+	return r.DB.Find(ctx, token)
+}
+
+func (r *recorder) Delete(ctx context.Context, token string) error {
+	r.record(ctx)
+	return r.DB.Delete(ctx, token)
+}
+
+func (r *recorder) Add(ctx context.Context, token string, data []byte, expires time.Time) error {
+	r.record(ctx)
+	return r.DB.Add(ctx, token, data, expires)
+}
+
+func (r *recorder) All(ctx context.Context) (map[string][]byte, error) {
+	r.record(ctx)
+	return r.DB.All(ctx)
+}
+
+func TestStoreContext(t *testing.T) {
+
+	check := require.New(t)
+
+	conn := &recorder{DB: sessions.NewDB()}
+
+	store, err := sessions.New(sessions.Database(conn), sessions.Cleanup(0), sessions.Timeout(time.Second))
+	check.NoError(err)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+
+	check.NoError(store.CommitCtx(ctx, "token", []byte("data"), time.Now().Add(time.Hour)))
+
+	_, ok, err := store.FindCtx(ctx, "token")
+	check.NoError(err)
+	check.True(ok)
+
+	_, err = store.AllCtx(ctx)
+	check.NoError(err)
+
+	check.NoError(store.DeleteCtx(ctx, "token"))
+
+	check.Equal([]any{"request", "request", "request", "request"}, conn.values)
+	check.Equal([]bool{true, true, true, true}, conn.deadlines)
+
+	// The old signatures still get a deadline.
+	_, _, err = store.Find("token")
+	check.NoError(err)
+	check.Nil(conn.values[4])
+	check.True(conn.deadlines[4])
+
+}
+
+func TestStoreIterate(t *testing.T) {
+
+	check := require.New(t)
+
+	store, err := sessions.New(sessions.Cleanup(0))
+	check.NoError(err)
+
+	manager := scs.New()
+	manager.Store = store
+
+	ctx := context.Background()
+
+	for x := 0; x < 6; x++ {
+
+		loaded, err := manager.Load(ctx, "")
+		check.NoError(err)
+
+		manager.Put(loaded, "user", fmt.Sprintf("user_%d", x%2))
+
+		_, _, err = manager.Commit(loaded)
+		check.NoError(err)
+	}
+
+	// Log out every session of user_0.
+	check.NoError(manager.Iterate(ctx, func(ctx context.Context) error {
+
+		if manager.GetString(ctx, "user") != "user_0" {
+			return nil
+		}
+
+		return manager.Destroy(ctx)
+	}))
+
+	all, err := store.All()
+	check.NoError(err)
+	check.Len(all, 3)
+
+	check.NoError(manager.Iterate(ctx, func(ctx context.Context) error {
+		check.Equal("user_1", manager.GetString(ctx, "user"))
+		return nil
+	}))
+
+}
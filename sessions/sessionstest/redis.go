@@ -0,0 +1,306 @@
+package sessionstest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type redisEntry struct {
+	value   string
+	expires time.Time
+}
+
+// redisServer understands just enough of the Redis protocol for sessions.Redis:
+// PING, AUTH, SELECT, GET, SET with PX, DEL, MGET and SCAN.
+type redisServer struct {
+	password string
+	mu       sync.Mutex
+	data     map[string]redisEntry
+	conns    map[net.Conn]struct{}
+}
+
+// RedisServer starts an in memory stand-in for a Redis server, returning its address.
+// Connections must AUTH with password first unless it is empty. It stops when the test ends.
+func RedisServer(t testing.TB, password string) string {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &redisServer{password: password, data: make(map[string]redisEntry), conns: make(map[net.Conn]struct{})}
+
+	var wg sync.WaitGroup
+
+	t.Cleanup(func() {
+
+		l.Close()
+
+		// Clients may still hold idle connections.
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+
+		wg.Wait()
+	})
+
+	wg.Add(1)
+
+	go func() {
+
+		defer wg.Done()
+
+		for {
+
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func (s *redisServer) serve(conn net.Conn) {
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authenticated := s.password == ""
+
+	for {
+
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(args[0])
+
+		switch {
+		case command == "AUTH":
+			authenticated = len(args) == 2 && args[1] == s.password
+			if authenticated {
+				fmt.Fprint(w, "+OK\r\n")
+			} else {
+				fmt.Fprint(w, "-WRONGPASS invalid password\r\n")
+			}
+
+		case !authenticated:
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+
+		default:
+			s.handle(w, command, args[1:])
+		}
+
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *redisServer) handle(w io.Writer, command string, args []string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch command {
+	case "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+
+	case "SELECT":
+		fmt.Fprint(w, "+OK\r\n")
+
+	case "GET":
+		if e, ok := s.live(args[0]); ok {
+			writeBulk(w, e.value)
+		} else {
+			fmt.Fprint(w, "$-1\r\n")
+		}
+
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, key := range args {
+			if e, ok := s.live(key); ok {
+				writeBulk(w, e.value)
+			} else {
+				fmt.Fprint(w, "$-1\r\n")
+			}
+		}
+
+	case "SET":
+		e := redisEntry{value: args[1]}
+		if len(args) == 4 && strings.EqualFold(args[2], "PX") {
+			ms, err := strconv.ParseInt(args[3], 10, 64)
+			if err != nil || ms <= 0 {
+				fmt.Fprint(w, "-ERR invalid expire time in 'set' command\r\n")
+				return
+			}
+			e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		s.data[args[0]] = e
+		fmt.Fprint(w, "+OK\r\n")
+
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			if _, ok := s.live(key); ok {
+				deleted++
+			}
+			delete(s.data, key)
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+
+	case "SCAN":
+		s.scan(w, args)
+
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", command)
+	}
+}
+
+// scan pages through the sorted keys, using the offset as the cursor.
+func (s *redisServer) scan(w io.Writer, args []string) {
+
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprint(w, "-ERR invalid cursor\r\n")
+		return
+	}
+
+	match, count := "*", 10
+
+	for x := 1; x+1 < len(args); x += 2 {
+		switch strings.ToUpper(args[x]) {
+		case "MATCH":
+			match = args[x+1]
+		case "COUNT":
+			if n, err := strconv.Atoi(args[x+1]); err == nil && n > 0 {
+				count = n
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(s.data))
+
+	for key := range s.data {
+		if _, ok := s.live(key); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var found []string
+
+	end := min(cursor+count, len(keys))
+
+	for _, key := range keys[min(cursor, len(keys)):end] {
+		if ok, _ := path.Match(match, key); ok {
+			found = append(found, key)
+		}
+	}
+
+	next := end
+	if next >= len(keys) {
+		next = 0
+	}
+
+	fmt.Fprintf(w, "*2\r\n")
+	writeBulk(w, strconv.Itoa(next))
+	fmt.Fprintf(w, "*%d\r\n", len(found))
+
+	for _, key := range found {
+		writeBulk(w, key)
+	}
+}
+
+// live returns the entry for key, removing it when it has expired.
+func (s *redisServer) live(key string) (redisEntry, bool) {
+
+	e, ok := s.data[key]
+	if !ok {
+		return e, false
+	}
+
+	if !e.expires.IsZero() && !e.expires.After(time.Now()) {
+		delete(s.data, key)
+		return e, false
+	}
+
+	return e, true
+}
+
+func writeBulk(w io.Writer, value string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+
+	size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+
+	args := make([]string, size)
+
+	for x := range args {
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, length+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		args[x] = string(b[:length])
+	}
+
+	return args, nil
+}
@@ -0,0 +1,137 @@
+// Package sessionstest has the conformance tests that every sessions.Connection must pass.
+package sessionstest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/stretchr/testify/require"
+)
+
+// Conformance runs the conformance tests against the connection returned by open.
+// Every subtest gets a new connection, open should return an empty store each time.
+// Connections that are a sessions.Sweeper must report exactly how many sessions they removed.
+func Conformance(t *testing.T, open func(t *testing.T) sessions.Connection) {
+
+	ctx := context.Background()
+
+	t.Run("find missing", func(t *testing.T) {
+
+		check := require.New(t)
+
+		conn := open(t)
+
+		_, err := conn.Find(ctx, "missing")
+		check.ErrorIs(err, sessions.ErrNotFound)
+
+	})
+
+	t.Run("add, find, and delete", func(t *testing.T) {
+
+		check := require.New(t)
+
+		conn := open(t)
+
+		check.NoError(conn.Add(ctx, "token", []byte("data"), time.Now().Add(time.Hour)))
+
+		data, err := conn.Find(ctx, "token")
+		check.NoError(err)
+		check.Equal([]byte("data"), data)
+
+		// Adding again replaces the data.
+		check.NoError(conn.Add(ctx, "token", []byte("replaced"), time.Now().Add(time.Hour)))
+
+		data, err = conn.Find(ctx, "token")
+		check.NoError(err)
+		check.Equal([]byte("replaced"), data)
+
+		check.NoError(conn.Delete(ctx, "token"))
+
+		_, err = conn.Find(ctx, "token")
+		check.ErrorIs(err, sessions.ErrNotFound)
+
+		// Deleting a missing token is not an error.
+		check.NoError(conn.Delete(ctx, "token"))
+
+	})
+
+	t.Run("expired", func(t *testing.T) {
+
+		check := require.New(t)
+
+		conn := open(t)
+
+		check.NoError(conn.Add(ctx, "expired", []byte("data"), time.Now().Add(-time.Minute)))
+
+		_, err := conn.Find(ctx, "expired")
+		check.ErrorIs(err, sessions.ErrNotFound)
+
+		all, err := conn.All(ctx)
+		check.NoError(err)
+		check.NotContains(all, "expired")
+
+	})
+
+	t.Run("all", func(t *testing.T) {
+
+		check := require.New(t)
+
+		conn := open(t)
+
+		all, err := conn.All(ctx)
+		check.NoError(err)
+		check.NotNil(all)
+		check.Empty(all)
+
+		want := map[string][]byte{}
+
+		for x := 0; x < 10; x++ {
+			token := fmt.Sprintf("token_%d", x)
+			want[token] = []byte(token)
+			check.NoError(conn.Add(ctx, token, []byte(token), time.Now().Add(time.Hour)))
+		}
+
+		all, err = conn.All(ctx)
+		check.NoError(err)
+		check.Equal(want, all)
+
+	})
+
+	t.Run("delete old", func(t *testing.T) {
+
+		check := require.New(t)
+
+		conn := open(t)
+
+		for x := 0; x < 25; x++ {
+			check.NoError(conn.Add(ctx, fmt.Sprintf("old_%d", x), []byte("old"), time.Now().Add(-time.Minute)))
+		}
+
+		check.NoError(conn.Add(ctx, "live", []byte("live"), time.Now().Add(time.Hour)))
+
+		if sweeper, ok := conn.(sessions.Sweeper); ok {
+			removed, err := sweeper.Sweep(ctx, time.Now())
+			check.NoError(err)
+			check.Equal(25, removed)
+
+			removed, err = sweeper.Sweep(ctx, time.Now())
+			check.NoError(err)
+			check.Zero(removed)
+		} else {
+			check.NoError(conn.DeleteOld(ctx, time.Now()))
+		}
+
+		data, err := conn.Find(ctx, "live")
+		check.NoError(err)
+		check.Equal([]byte("live"), data)
+
+		all, err := conn.All(ctx)
+		check.NoError(err)
+		check.Len(all, 1)
+
+	})
+
+}
@@ -0,0 +1,291 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("session not found")
+	ErrInvalidTable   = errors.New("invalid table name")
+	ErrInvalidBatch   = errors.New("batch size must be positive")
+	ErrInvalidDialect = errors.New("invalid dialect")
+	ErrMissingSQL     = errors.New("missing *sql.DB")
+)
+
+// Dialect is the flavor of SQL spoken by the database given to NewSQL.
+type Dialect int
+
+const (
+	// SQLite works with the "sqlite3" driver registered by github.com/hcarriz/reverb/sqlite.
+	SQLite Dialect = iota
+	// Postgres works with any database/sql Postgres driver.
+	Postgres
+)
+
+var validTable = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SQLOption configures NewSQL.
+type SQLOption interface {
+	apply(*SQL) error
+}
+
+type sqlOption func(*SQL) error
+
+func (o sqlOption) apply(s *SQL) error {
+	return o(s)
+}
+
+// Table sets the name of the table sessions are kept in. The default is "sessions".
+func Table(name string) SQLOption {
+	return sqlOption(func(s *SQL) error {
+
+		if !validTable.MatchString(name) {
+			return ErrInvalidTable
+		}
+
+		s.table = name
+
+		return nil
+	})
+}
+
+// BatchSize sets how many expired sessions DeleteOld removes per statement.
+func BatchSize(size int) SQLOption {
+	return sqlOption(func(s *SQL) error {
+
+		if size < 1 {
+			return ErrInvalidBatch
+		}
+
+		s.batch = size
+
+		return nil
+	})
+}
+
+// SQL is a Connection backed by database/sql.
+type SQL struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	batch   int
+}
+
+// NewSQL returns a Connection using db, creating or migrating the schema as needed.
+func NewSQL(ctx context.Context, db *sql.DB, dialect Dialect, opts ...SQLOption) (*SQL, error) {
+
+	if db == nil {
+		return nil, ErrMissingSQL
+	}
+
+	if dialect != SQLite && dialect != Postgres {
+		return nil, ErrInvalidDialect
+	}
+
+	s := &SQL{
+		db:      db,
+		dialect: dialect,
+		table:   "sessions",
+		batch:   500,
+	}
+
+	var err error
+
+	for _, opt := range opts {
+		err = errors.Join(err, opt.apply(s))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Ping checks that the database is reachable.
+func (s *SQL) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// migrations returns the statements that bring the schema to each version, in order.
+func (s *SQL) migrations() [][]string {
+
+	data, expiry := "BLOB", "INTEGER"
+	if s.dialect == Postgres {
+		data, expiry = "BYTEA", "BIGINT"
+	}
+
+	return [][]string{
+		{
+			fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (token TEXT PRIMARY KEY, data %s NOT NULL, expiry %s NOT NULL)", s.table, data, expiry),
+		},
+		{
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expiry_idx ON %s (expiry)", s.table, s.table),
+		},
+	}
+}
+
+// Migrate creates the table and applies any migrations that have not been applied yet.
+// Applied versions are kept in a table named after the sessions table with a "_migrations" suffix.
+func (s *SQL) Migrate(ctx context.Context) error {
+
+	versions := s.table + "_migrations"
+
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER PRIMARY KEY)", versions)); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var current sql.NullInt64
+
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %s", versions)).Scan(&current); err != nil {
+		return err
+	}
+
+	for x, statements := range s.migrations() {
+
+		version := int64(x + 1)
+
+		if current.Valid && version <= current.Int64 {
+			continue
+		}
+
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migration %d: %w", version, err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, s.query(fmt.Sprintf("INSERT INTO %s (version) VALUES (?) ON CONFLICT (version) DO NOTHING", versions)), version); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// query rewrites the ? placeholders for the dialect.
+func (s *SQL) query(q string) string {
+
+	if s.dialect != Postgres {
+		return q
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+
+	for _, r := range q {
+
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+func (s *SQL) Find(ctx context.Context, token string) ([]byte, error) {
+
+	var data []byte
+
+	err := s.db.QueryRowContext(ctx, s.query(fmt.Sprintf("SELECT data FROM %s WHERE token = ? AND expiry > ?", s.table)), token, time.Now().UnixMilli()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s *SQL) Delete(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, s.query(fmt.Sprintf("DELETE FROM %s WHERE token = ?", s.table)), token)
+	return err
+}
+
+func (s *SQL) Add(ctx context.Context, token string, data []byte, expires time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.query(fmt.Sprintf("INSERT INTO %s (token, data, expiry) VALUES (?, ?, ?) ON CONFLICT (token) DO UPDATE SET data = excluded.data, expiry = excluded.expiry", s.table)), token, data, expires.UnixMilli())
+	return err
+}
+
+func (s *SQL) All(ctx context.Context) (map[string][]byte, error) {
+
+	rows, err := s.db.QueryContext(ctx, s.query(fmt.Sprintf("SELECT token, data FROM %s WHERE expiry > ?", s.table)), time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make(map[string][]byte)
+
+	for rows.Next() {
+
+		var (
+			token string
+			data  []byte
+		)
+
+		if err := rows.Scan(&token, &data); err != nil {
+			return nil, err
+		}
+
+		result[token] = data
+	}
+
+	return result, rows.Err()
+}
+
+// DeleteOld removes the sessions that expired at or before old, BatchSize rows at a time.
+func (s *SQL) DeleteOld(ctx context.Context, old time.Time) error {
+	_, err := s.Sweep(ctx, old)
+	return err
+}
+
+// Sweep is DeleteOld returning how many sessions were removed.
+func (s *SQL) Sweep(ctx context.Context, old time.Time) (int, error) {
+
+	q := s.query(fmt.Sprintf("DELETE FROM %s WHERE token IN (SELECT token FROM %s WHERE expiry <= ? LIMIT ?)", s.table, s.table))
+
+	removed := 0
+
+	for {
+
+		result, err := s.db.ExecContext(ctx, q, old.UnixMilli(), s.batch)
+		if err != nil {
+			return removed, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return removed, err
+		}
+
+		removed += int(affected)
+
+		if affected < int64(s.batch) {
+			return removed, nil
+		}
+	}
+}
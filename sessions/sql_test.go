@@ -0,0 +1,167 @@
+package sessions_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hcarriz/reverb/sessions"
+	"github.com/hcarriz/reverb/sessions/sessionstest"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/hcarriz/reverb/sqlite"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+
+	check := require.New(t)
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	check.NoError(err)
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestSQL(t *testing.T) {
+
+	sessionstest.Conformance(t, func(t *testing.T) sessions.Connection {
+
+		check := require.New(t)
+
+		conn, err := sessions.NewSQL(context.Background(), openSQLite(t), sessions.SQLite, sessions.BatchSize(10))
+		check.NoError(err)
+
+		return conn
+	})
+
+}
+
+// TestSQLPostgres runs the conformance tests against the database of REVERB_POSTGRES_DSN, and is skipped without it.
+// A database/sql driver for Postgres must be linked into the test binary, REVERB_POSTGRES_DRIVER names it, pgx by default.
+func TestSQLPostgres(t *testing.T) {
+
+	dsn := os.Getenv("REVERB_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("REVERB_POSTGRES_DSN is not set")
+	}
+
+	driver := os.Getenv("REVERB_POSTGRES_DRIVER")
+	if driver == "" {
+		driver = "pgx"
+	}
+
+	if !slices.Contains(sql.Drivers(), driver) {
+		t.Skipf("the %q driver is not linked into the test binary", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { db.Close() })
+
+	var tables atomic.Int32
+
+	sessionstest.Conformance(t, func(t *testing.T) sessions.Connection {
+
+		check := require.New(t)
+
+		// Every subtest gets its own table, so it starts empty.
+		table := fmt.Sprintf("reverb_sessions_%d_%d", time.Now().UnixNano(), tables.Add(1))
+
+		t.Cleanup(func() {
+			_, _ = db.Exec("DROP TABLE IF EXISTS " + table)
+			_, _ = db.Exec("DROP TABLE IF EXISTS " + table + "_migrations")
+		})
+
+		conn, err := sessions.NewSQL(context.Background(), db, sessions.Postgres, sessions.Table(table), sessions.BatchSize(10))
+		check.NoError(err)
+
+		return conn
+	})
+
+}
+
+func TestNewSQL(t *testing.T) {
+
+	check := require.New(t)
+
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	_, err := sessions.NewSQL(ctx, nil, sessions.SQLite)
+	check.ErrorIs(err, sessions.ErrMissingSQL)
+
+	_, err = sessions.NewSQL(ctx, db, sessions.Dialect(5))
+	check.ErrorIs(err, sessions.ErrInvalidDialect)
+
+	_, err = sessions.NewSQL(ctx, db, sessions.SQLite, sessions.Table("drop table;"))
+	check.ErrorIs(err, sessions.ErrInvalidTable)
+
+	_, err = sessions.NewSQL(ctx, db, sessions.SQLite, sessions.BatchSize(0))
+	check.ErrorIs(err, sessions.ErrInvalidBatch)
+
+	// Migrating twice keeps the data and the applied versions.
+	conn, err := sessions.NewSQL(ctx, db, sessions.SQLite, sessions.Table("app_sessions"))
+	check.NoError(err)
+	check.NoError(conn.Add(ctx, "token", []byte("data"), time.Now().Add(time.Hour)))
+
+	conn, err = sessions.NewSQL(ctx, db, sessions.SQLite, sessions.Table("app_sessions"))
+	check.NoError(err)
+
+	data, err := conn.Find(ctx, "token")
+	check.NoError(err)
+	check.Equal([]byte("data"), data)
+
+	var versions int
+	check.NoError(db.QueryRow("SELECT COUNT(*) FROM app_sessions_migrations").Scan(&versions))
+	check.Equal(2, versions)
+
+	// The store works on top of it.
+	store, err := sessions.New(sessions.Database(conn), sessions.Cleanup(0))
+	check.NoError(err)
+
+	found, ok, err := store.Find("token")
+	check.NoError(err)
+	check.True(ok)
+	check.Equal([]byte("data"), found)
+
+}
+
+func TestPostgresQuery(t *testing.T) {
+
+	check := require.New(t)
+
+	check.Equal("SELECT data FROM sessions WHERE token = $1 AND expiry > $2", sessions.PostgresQuery("SELECT data FROM sessions WHERE token = ? AND expiry > ?"))
+
+}
+
+func TestSQLPing(t *testing.T) {
+
+	check := require.New(t)
+
+	db := openSQLite(t)
+
+	conn, err := sessions.NewSQL(context.Background(), db, sessions.SQLite)
+	check.NoError(err)
+
+	store, err := sessions.New(sessions.Cleanup(0), sessions.Database(conn))
+	check.NoError(err)
+
+	check.NoError(store.Ping(context.Background()))
+
+	check.NoError(db.Close())
+	check.Error(store.Ping(context.Background()))
+
+	// The in memory connection is always reachable.
+	store, err = sessions.New(sessions.Cleanup(0))
+	check.NoError(err)
+	check.NoError(store.Ping(context.Background()))
+
+}
@@ -13,9 +13,11 @@ func (v Value) String() string {
 }
 
 var (
-	ContextUserID = Value{"viewer_user_id"}
-	ContextSystem = Value{"viewer_system"}
-	ContextIP     = Value{"viewer_ip"}
+	ContextUserID  = Value{"viewer_user_id"}
+	ContextSystem  = Value{"viewer_system"}
+	ContextIP      = Value{"viewer_ip"}
+	ContextService = Value{"viewer_service"}
+	ContextBearer  = Value{"viewer_bearer"}
 )
 
 type ID interface {
@@ -79,3 +81,25 @@ func GetAddress(ctx context.Context) string {
 	return "127.0.0.1"
 
 }
+
+// Service
+
+func SetService(ctx context.Context, name string) context.Context {
+	return Set(ctx, ContextService, name)
+}
+
+func GetService(ctx context.Context) (string, bool) {
+	return Get[string](ctx, ContextService)
+}
+
+// Bearer
+
+// SetBearer marks the request as authenticated by a bearer token, which csrf exempts.
+func SetBearer(ctx context.Context) context.Context {
+	return setter(ctx, ContextBearer, true)
+}
+
+func IsBearer(ctx context.Context) bool {
+	result, ok := getter[bool](ctx, ContextBearer)
+	return ok && result
+}
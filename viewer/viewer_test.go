@@ -41,6 +41,21 @@ func TestViewer(t *testing.T) {
 
 	check.True(IsSystem(ctx))
 
+	_, ok = GetService(ctx)
+	check.False(ok)
+
+	ctx = SetService(ctx, "worker")
+
+	svc, ok := GetService(ctx)
+	check.True(ok)
+	check.Equal("worker", svc)
+
+	check.False(IsBearer(ctx))
+
+	ctx = SetBearer(ctx)
+
+	check.True(IsBearer(ctx))
+
 }
 
 func TestComplete(t *testing.T) {